@@ -0,0 +1,234 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/bytefmt"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/localdriver"
+	"code.cloudfoundry.org/localdriver/ratelimit"
+)
+
+const (
+	ListRoute      = "GET /volumes"
+	MoveRoute      = "POST /volumes/{name}/move"
+	HeartbeatRoute = "POST /volumes/{name}/heartbeat"
+	ResizeRoute    = "POST /volumes/{name}/resize"
+	ListTrashRoute = "GET /trash"
+	RestoreRoute   = "POST /trash/{id}/restore"
+	MetricsRoute   = "GET /metrics"
+	LimitsRoute    = "GET /limits"
+	SetLimitsRoute = "PUT /limits"
+)
+
+type VolumeAdmin interface {
+	ListVolumes(env dockerdriver.Env, listRequest localdriver.ListVolumesRequest) dockerdriver.ListResponse
+	Move(env dockerdriver.Env, moveRequest localdriver.MoveRequest) dockerdriver.ErrorResponse
+	Heartbeat(env dockerdriver.Env, heartbeatRequest localdriver.HeartbeatRequest) dockerdriver.ErrorResponse
+	Resize(env dockerdriver.Env, resizeRequest localdriver.ResizeRequest) dockerdriver.ErrorResponse
+	ListTrash(env dockerdriver.Env) localdriver.ListTrashResponse
+	Restore(env dockerdriver.Env, restoreRequest localdriver.RestoreRequest) dockerdriver.ErrorResponse
+	PoolCapacities(env dockerdriver.Env) []localdriver.PoolCapacity
+}
+
+// RateLimiter exposes the request limits so they can be inspected and
+// changed at runtime.
+type RateLimiter interface {
+	Limits() ratelimit.Limits
+	SetLimits(limits ratelimit.Limits) error
+	Metrics() ratelimit.Metrics
+}
+
+type MetricsResponse struct {
+	RateLimit ratelimit.Metrics          `json:"rate_limit"`
+	Pools     []localdriver.PoolCapacity `json:"pools"`
+}
+
+type MoveBody struct {
+	Pool string `json:"pool"`
+}
+
+type HeartbeatBody struct {
+	Holder string `json:"holder"`
+}
+
+// ResizeBody gives the new size as a byte quantity such as "512M".
+type ResizeBody struct {
+	Size string `json:"size"`
+}
+
+// NewHandler serves the operator facing volume operations that are not part
+// of the docker volume plugin protocol.
+func NewHandler(logger lager.Logger, volumeAdmin VolumeAdmin, rateLimiter RateLimiter) http.Handler {
+	logger = logger.Session("admin-handler")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(ListRoute, func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-list")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		labels, err := labelFilters(req.URL.Query()["label"])
+		if err != nil {
+			logger.Error("invalid-label-filter", err)
+			writeJSONResponse(w, http.StatusBadRequest, dockerdriver.ListResponse{Err: err.Error()})
+			return
+		}
+
+		env := driverhttp.NewHttpDriverEnv(logger, req.Context())
+		response := volumeAdmin.ListVolumes(env, localdriver.ListVolumesRequest{Labels: labels})
+		if response.Err != "" {
+			writeJSONResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, response)
+	})
+
+	mux.HandleFunc(MoveRoute, func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-move")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		var body MoveBody
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			logger.Error("failed-parsing-move-request-body", err)
+			writeJSONResponse(w, http.StatusBadRequest, dockerdriver.ErrorResponse{Err: err.Error()})
+			return
+		}
+
+		env := driverhttp.NewHttpDriverEnv(logger, req.Context())
+		response := volumeAdmin.Move(env, localdriver.MoveRequest{Name: req.PathValue("name"), Pool: body.Pool})
+		writeErrorResponse(w, response)
+	})
+
+	mux.HandleFunc(HeartbeatRoute, func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-heartbeat")
+
+		var body HeartbeatBody
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			logger.Error("failed-parsing-heartbeat-request-body", err)
+			writeJSONResponse(w, http.StatusBadRequest, dockerdriver.ErrorResponse{Err: err.Error()})
+			return
+		}
+
+		env := driverhttp.NewHttpDriverEnv(logger, req.Context())
+		response := volumeAdmin.Heartbeat(env, localdriver.HeartbeatRequest{Name: req.PathValue("name"), Holder: body.Holder})
+		writeErrorResponse(w, response)
+	})
+
+	mux.HandleFunc(ResizeRoute, func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-resize")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		var body ResizeBody
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			logger.Error("failed-parsing-resize-request-body", err)
+			writeJSONResponse(w, http.StatusBadRequest, dockerdriver.ErrorResponse{Err: err.Error()})
+			return
+		}
+		size, err := bytefmt.ToBytes(body.Size)
+		if err != nil {
+			logger.Error("invalid-size", err)
+			writeJSONResponse(w, http.StatusBadRequest, dockerdriver.ErrorResponse{Err: fmt.Sprintf("invalid size '%s': %s", body.Size, err)})
+			return
+		}
+
+		env := driverhttp.NewHttpDriverEnv(logger, req.Context())
+		response := volumeAdmin.Resize(env, localdriver.ResizeRequest{Name: req.PathValue("name"), Size: size})
+		writeErrorResponse(w, response)
+	})
+
+	mux.HandleFunc(ListTrashRoute, func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-list-trash")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		env := driverhttp.NewHttpDriverEnv(logger, req.Context())
+		response := volumeAdmin.ListTrash(env)
+		if response.Err != "" {
+			writeJSONResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, response)
+	})
+
+	mux.HandleFunc(RestoreRoute, func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-restore")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		env := driverhttp.NewHttpDriverEnv(logger, req.Context())
+		response := volumeAdmin.Restore(env, localdriver.RestoreRequest{ID: req.PathValue("id")})
+		writeErrorResponse(w, response)
+	})
+
+	mux.HandleFunc(MetricsRoute, func(w http.ResponseWriter, req *http.Request) {
+		env := driverhttp.NewHttpDriverEnv(logger, req.Context())
+		writeJSONResponse(w, http.StatusOK, MetricsResponse{RateLimit: rateLimiter.Metrics(), Pools: volumeAdmin.PoolCapacities(env)})
+	})
+
+	mux.HandleFunc(LimitsRoute, func(w http.ResponseWriter, req *http.Request) {
+		writeJSONResponse(w, http.StatusOK, rateLimiter.Limits())
+	})
+
+	mux.HandleFunc(SetLimitsRoute, func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-set-limits")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		// start from the current limits so that a body may name only some of them
+		limits := rateLimiter.Limits()
+		if err := json.NewDecoder(req.Body).Decode(&limits); err != nil {
+			logger.Error("failed-parsing-limits-request-body", err)
+			writeJSONResponse(w, http.StatusBadRequest, dockerdriver.ErrorResponse{Err: err.Error()})
+			return
+		}
+
+		if err := rateLimiter.SetLimits(limits); err != nil {
+			logger.Error("invalid-limits", err)
+			writeJSONResponse(w, http.StatusBadRequest, dockerdriver.ErrorResponse{Err: err.Error()})
+			return
+		}
+		logger.Info("limits-changed", lager.Data{"limits": limits})
+		writeJSONResponse(w, http.StatusOK, limits)
+	})
+
+	return mux
+}
+
+// labelFilters parses repeated "label=key=value" query parameters.
+func labelFilters(filters []string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, filter := range filters {
+		key, value, ok := strings.Cut(filter, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label filter '%s': expected key=value", filter)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+func writeErrorResponse(w http.ResponseWriter, response dockerdriver.ErrorResponse) {
+	if response.Err != "" {
+		writeJSONResponse(w, http.StatusInternalServerError, response)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+func writeJSONResponse(w http.ResponseWriter, statusCode int, jsonObj interface{}) {
+	jsonBytes, err := json.Marshal(jsonObj)
+	if err != nil {
+		panic("Unable to encode JSON: " + err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(jsonBytes)
+}
@@ -0,0 +1,295 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/localdriver"
+	"code.cloudfoundry.org/localdriver/admin"
+	"code.cloudfoundry.org/localdriver/ratelimit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeVolumeAdmin struct {
+	listRequests []localdriver.ListVolumesRequest
+	listResponse dockerdriver.ListResponse
+	moveRequests []localdriver.MoveRequest
+	moveResponse dockerdriver.ErrorResponse
+
+	heartbeatRequests []localdriver.HeartbeatRequest
+	heartbeatResponse dockerdriver.ErrorResponse
+
+	resizeRequests []localdriver.ResizeRequest
+	resizeResponse dockerdriver.ErrorResponse
+
+	poolCapacities []localdriver.PoolCapacity
+
+	listTrashResponse localdriver.ListTrashResponse
+	restoreRequests   []localdriver.RestoreRequest
+	restoreResponse   dockerdriver.ErrorResponse
+}
+
+func (f *fakeVolumeAdmin) ListTrash(_ dockerdriver.Env) localdriver.ListTrashResponse {
+	return f.listTrashResponse
+}
+
+func (f *fakeVolumeAdmin) Restore(_ dockerdriver.Env, restoreRequest localdriver.RestoreRequest) dockerdriver.ErrorResponse {
+	f.restoreRequests = append(f.restoreRequests, restoreRequest)
+	return f.restoreResponse
+}
+
+func (f *fakeVolumeAdmin) ListVolumes(_ dockerdriver.Env, listRequest localdriver.ListVolumesRequest) dockerdriver.ListResponse {
+	f.listRequests = append(f.listRequests, listRequest)
+	return f.listResponse
+}
+
+func (f *fakeVolumeAdmin) Move(_ dockerdriver.Env, moveRequest localdriver.MoveRequest) dockerdriver.ErrorResponse {
+	f.moveRequests = append(f.moveRequests, moveRequest)
+	return f.moveResponse
+}
+
+func (f *fakeVolumeAdmin) Heartbeat(_ dockerdriver.Env, heartbeatRequest localdriver.HeartbeatRequest) dockerdriver.ErrorResponse {
+	f.heartbeatRequests = append(f.heartbeatRequests, heartbeatRequest)
+	return f.heartbeatResponse
+}
+
+func (f *fakeVolumeAdmin) Resize(_ dockerdriver.Env, resizeRequest localdriver.ResizeRequest) dockerdriver.ErrorResponse {
+	f.resizeRequests = append(f.resizeRequests, resizeRequest)
+	return f.resizeResponse
+}
+
+func (f *fakeVolumeAdmin) PoolCapacities(_ dockerdriver.Env) []localdriver.PoolCapacity {
+	return f.poolCapacities
+}
+
+var _ = Describe("Admin Handler", func() {
+	var (
+		volumeAdmin *fakeVolumeAdmin
+		rateLimiter *ratelimit.Limiter
+		handler     http.Handler
+		recorder    *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		volumeAdmin = &fakeVolumeAdmin{}
+		rateLimiter = ratelimit.NewLimiter(fakeclock.NewFakeClock(time.Now()), ratelimit.Limits{ClientRate: 5})
+		recorder = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		handler = admin.NewHandler(lagertest.NewTestLogger("admin"), volumeAdmin, rateLimiter)
+	})
+
+	decodeErrorResponse := func() dockerdriver.ErrorResponse {
+		var response dockerdriver.ErrorResponse
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+		return response
+	}
+
+	Describe("list", func() {
+		BeforeEach(func() {
+			volumeAdmin.listResponse = dockerdriver.ListResponse{Volumes: []dockerdriver.VolumeInfo{{Name: "some-volume"}}}
+		})
+
+		It("passes the label filters on and returns the volumes", func() {
+			request := httptest.NewRequest("GET", "/volumes?label=suite=smoke&label=run=a=b", nil)
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(volumeAdmin.listRequests).To(ConsistOf(localdriver.ListVolumesRequest{Labels: map[string]string{"suite": "smoke", "run": "a=b"}}))
+
+			var response dockerdriver.ListResponse
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.Volumes).To(HaveLen(1))
+			Expect(response.Volumes[0].Name).To(Equal("some-volume"))
+		})
+
+		It("rejects malformed label filters", func() {
+			request := httptest.NewRequest("GET", "/volumes?label=suite", nil)
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(volumeAdmin.listRequests).To(BeEmpty())
+		})
+	})
+
+	Describe("heartbeat", func() {
+		It("renews the lease of the holder", func() {
+			request := httptest.NewRequest("POST", "/volumes/some-volume/heartbeat", strings.NewReader(`{"holder":"container-1"}`))
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(volumeAdmin.heartbeatRequests).To(ConsistOf(localdriver.HeartbeatRequest{Name: "some-volume", Holder: "container-1"}))
+		})
+
+		Context("when the lease cannot be renewed", func() {
+			BeforeEach(func() {
+				volumeAdmin.heartbeatResponse = dockerdriver.ErrorResponse{Err: "Volume 'some-volume' is not mounted by 'container-1'"}
+			})
+
+			It("returns the error", func() {
+				request := httptest.NewRequest("POST", "/volumes/some-volume/heartbeat", strings.NewReader(`{"holder":"container-1"}`))
+				handler.ServeHTTP(recorder, request)
+
+				Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+				Expect(decodeErrorResponse().Err).To(Equal("Volume 'some-volume' is not mounted by 'container-1'"))
+			})
+		})
+	})
+
+	Describe("resize", func() {
+		It("resizes the named volume", func() {
+			request := httptest.NewRequest("POST", "/volumes/some-volume/resize", strings.NewReader(`{"size":"512M"}`))
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(volumeAdmin.resizeRequests).To(ConsistOf(localdriver.ResizeRequest{Name: "some-volume", Size: 512 * 1024 * 1024}))
+		})
+
+		It("rejects sizes it cannot parse", func() {
+			request := httptest.NewRequest("POST", "/volumes/some-volume/resize", strings.NewReader(`{"size":"big"}`))
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(decodeErrorResponse().Err).To(HavePrefix("invalid size 'big'"))
+			Expect(volumeAdmin.resizeRequests).To(BeEmpty())
+		})
+
+		Context("when the volume cannot be resized", func() {
+			BeforeEach(func() {
+				volumeAdmin.resizeResponse = dockerdriver.ErrorResponse{Err: "Volume 'some-volume' uses 2G, more than 1G"}
+			})
+
+			It("returns the error", func() {
+				request := httptest.NewRequest("POST", "/volumes/some-volume/resize", strings.NewReader(`{"size":"1G"}`))
+				handler.ServeHTTP(recorder, request)
+
+				Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+				Expect(decodeErrorResponse().Err).To(Equal("Volume 'some-volume' uses 2G, more than 1G"))
+			})
+		})
+	})
+
+	Describe("move", func() {
+		It("moves the named volume to the requested pool", func() {
+			request := httptest.NewRequest("POST", "/volumes/some-volume/move", strings.NewReader(`{"pool":"other"}`))
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(volumeAdmin.moveRequests).To(ConsistOf(localdriver.MoveRequest{Name: "some-volume", Pool: "other"}))
+			Expect(decodeErrorResponse().Err).To(BeEmpty())
+		})
+
+		Context("when the move fails", func() {
+			BeforeEach(func() {
+				volumeAdmin.moveResponse = dockerdriver.ErrorResponse{Err: "badness"}
+			})
+
+			It("returns the error", func() {
+				request := httptest.NewRequest("POST", "/volumes/some-volume/move", strings.NewReader(`{"pool":"other"}`))
+				handler.ServeHTTP(recorder, request)
+
+				Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+				Expect(decodeErrorResponse().Err).To(Equal("badness"))
+			})
+		})
+
+		Context("when the body is not valid JSON", func() {
+			It("returns a bad request", func() {
+				request := httptest.NewRequest("POST", "/volumes/some-volume/move", strings.NewReader(`{`))
+				handler.ServeHTTP(recorder, request)
+
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(volumeAdmin.moveRequests).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("trash", func() {
+		It("lists the trashed volumes", func() {
+			volumeAdmin.listTrashResponse = localdriver.ListTrashResponse{Volumes: []localdriver.TrashedVolume{{ID: "some-volume.20200101T000000.000000000Z", Name: "some-volume"}}}
+
+			request := httptest.NewRequest("GET", "/trash", nil)
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			var response localdriver.ListTrashResponse
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.Volumes).To(HaveLen(1))
+			Expect(response.Volumes[0].Name).To(Equal("some-volume"))
+		})
+
+		It("restores a trashed volume by id", func() {
+			request := httptest.NewRequest("POST", "/trash/some-volume.20200101T000000.000000000Z/restore", nil)
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(volumeAdmin.restoreRequests).To(ConsistOf(localdriver.RestoreRequest{ID: "some-volume.20200101T000000.000000000Z"}))
+		})
+
+		It("returns restore errors", func() {
+			volumeAdmin.restoreResponse = dockerdriver.ErrorResponse{Err: "Volume 'some-volume' already exists"}
+
+			request := httptest.NewRequest("POST", "/trash/some-id/restore", nil)
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(decodeErrorResponse().Err).To(Equal("Volume 'some-volume' already exists"))
+		})
+	})
+	Describe("limits", func() {
+		It("reports the current limits", func() {
+			request := httptest.NewRequest("GET", "/limits", nil)
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(MatchJSON(`{"global_rate": 0, "global_burst": 0, "client_rate": 5, "client_burst": 0, "max_concurrent_operations": 0}`))
+		})
+
+		It("changes only the limits named in the body", func() {
+			request := httptest.NewRequest("PUT", "/limits", strings.NewReader(`{"global_rate": 100, "max_concurrent_operations": 4}`))
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(rateLimiter.Limits()).To(Equal(ratelimit.Limits{GlobalRate: 100, ClientRate: 5, MaxConcurrentOperations: 4}))
+		})
+
+		It("rejects invalid limits", func() {
+			request := httptest.NewRequest("PUT", "/limits", strings.NewReader(`{"client_rate": -1}`))
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(decodeErrorResponse().Err).To(Equal("client_rate must not be negative"))
+			Expect(rateLimiter.Limits().ClientRate).To(Equal(5.0))
+		})
+
+		It("serves the rate limit metrics", func() {
+			request := httptest.NewRequest("GET", "/metrics", nil)
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			var response admin.MetricsResponse
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.RateLimit.Limits.ClientRate).To(Equal(5.0))
+		})
+
+		It("serves the capacity of each pool", func() {
+			volumeAdmin.poolCapacities = []localdriver.PoolCapacity{{Name: "default", TotalBytes: 100, FreeBytes: 40, TotalInodes: 10, FreeInodes: 4}}
+
+			request := httptest.NewRequest("GET", "/metrics", nil)
+			handler.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			var response map[string]json.RawMessage
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response["pools"]).To(MatchJSON(`[{"name": "default", "total_bytes": 100, "free_bytes": 40, "total_inodes": 10, "free_inodes": 4, "below_minimum": false}]`))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package authorization_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAuthorization(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Authorization Suite")
+}
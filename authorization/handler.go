@@ -0,0 +1,236 @@
+package authorization
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// routeOperations maps the volume plugin routes to the operations policies
+// refer to. Routes that are not listed, such as Plugin.Activate and
+// VolumeDriver.Capabilities, reveal nothing about volumes and are always
+// allowed. Renewing a mount lease is part of mounting.
+var routeOperations = map[string]string{
+	"/VolumeDriver.Create":    OperationCreate,
+	"/VolumeDriver.Remove":    OperationRemove,
+	"/VolumeDriver.Mount":     OperationMount,
+	"/VolumeDriver.Heartbeat": OperationMount,
+	"/VolumeDriver.Unmount":   OperationUnmount,
+	"/VolumeDriver.Get":       OperationGet,
+	"/VolumeDriver.Path":      OperationPath,
+	"/VolumeDriver.List":      OperationList,
+}
+
+type handler struct {
+	logger   lager.Logger
+	policies []Policy
+	next     http.Handler
+}
+
+// NewHandler only passes requests on to next when one of the policies allows
+// the client certificate to perform the operation on the volume named in the
+// request. Denied requests are answered with an ErrorResponse and logged to
+// the audit session. List responses are filtered down to the volumes the
+// client may see.
+func NewHandler(logger lager.Logger, policies []Policy, next http.Handler) http.Handler {
+	return &handler{
+		logger:   logger.Session("audit"),
+		policies: policies,
+		next:     next,
+	}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	operation, ok := routeOperations[req.URL.Path]
+	if !ok {
+		h.next.ServeHTTP(w, req)
+		return
+	}
+
+	identities := clientIdentities(req)
+	if len(identities) == 0 {
+		h.deny(w, identities, operation, "", "a client certificate is required")
+		return
+	}
+
+	var allowing []Policy
+	for _, policy := range h.policies {
+		if policy.matchesClient(identities) && policy.allowsOperation(operation) {
+			allowing = append(allowing, policy)
+		}
+	}
+	if len(allowing) == 0 {
+		h.deny(w, identities, operation, "", fmt.Sprintf("client is not authorized to %s volumes", operation))
+		return
+	}
+
+	if operation == OperationList {
+		h.serveFilteredList(w, req, allowing)
+		return
+	}
+
+	name, err := volumeName(req)
+	if err != nil {
+		h.logger.Error("failed-reading-request-body", err, lager.Data{"operation": operation})
+		writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !anyAllowsVolume(allowing, name) {
+		h.deny(w, identities, operation, name, fmt.Sprintf("client is not authorized to %s volume '%s'", operation, name))
+		return
+	}
+
+	h.logger.Debug("allowed", lager.Data{"client": identities, "operation": operation, "volume": name})
+	h.next.ServeHTTP(w, req)
+}
+
+// NewAdminHandler only passes requests on to next when one of the policies
+// grants the client certificate the admin operation.
+func NewAdminHandler(logger lager.Logger, policies []Policy, next http.Handler) http.Handler {
+	return &adminHandler{handler{
+		logger:   logger.Session("audit"),
+		policies: policies,
+		next:     next,
+	}}
+}
+
+type adminHandler struct {
+	handler
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	identities := clientIdentities(req)
+	if len(identities) == 0 {
+		h.deny(w, identities, OperationAdmin, "", "a client certificate is required")
+		return
+	}
+
+	for _, policy := range h.policies {
+		if policy.matchesClient(identities) && policy.allowsAdmin() {
+			h.logger.Debug("allowed", lager.Data{"client": identities, "operation": OperationAdmin, "path": req.URL.Path})
+			h.next.ServeHTTP(w, req)
+			return
+		}
+	}
+	h.deny(w, identities, OperationAdmin, "", "client is not authorized to use the admin API")
+}
+
+func (h *handler) deny(w http.ResponseWriter, identities []string, operation, volume, reason string) {
+	h.logger.Info("denied", lager.Data{"client": identities, "operation": operation, "volume": volume, "reason": reason})
+	writeErrorResponse(w, http.StatusForbidden, reason)
+}
+
+// serveFilteredList removes the volumes none of the policies allow from the
+// List response.
+func (h *handler) serveFilteredList(w http.ResponseWriter, req *http.Request, allowing []Policy) {
+	recorder := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+	h.next.ServeHTTP(recorder, req)
+
+	var response dockerdriver.ListResponse
+	if err := json.Unmarshal(recorder.body.Bytes(), &response); err != nil {
+		h.logger.Error("failed-parsing-list-response", err)
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	volumes := []dockerdriver.VolumeInfo{}
+	for _, volume := range response.Volumes {
+		if anyAllowsVolume(allowing, volume.Name) {
+			volumes = append(volumes, volume)
+		}
+	}
+	response.Volumes = volumes
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for key, values := range recorder.header {
+		w.Header()[key] = values
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(recorder.status)
+	w.Write(body)
+}
+
+func anyAllowsVolume(policies []Policy, name string) bool {
+	for _, policy := range policies {
+		if policy.allowsVolume(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIdentities lists the identities of the verified client certificate
+// in the form policy subjects are written in.
+func clientIdentities(req *http.Request) []string {
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	cert := req.TLS.PeerCertificates[0]
+
+	var identities []string
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, "CN="+cert.Subject.CommonName)
+	}
+	for _, name := range cert.DNSNames {
+		identities = append(identities, "DNS="+name)
+	}
+	for _, uri := range cert.URIs {
+		identities = append(identities, "URI="+uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		identities = append(identities, "IP="+ip.String())
+	}
+	for _, email := range cert.EmailAddresses {
+		identities = append(identities, "EMAIL="+email)
+	}
+	return identities
+}
+
+// volumeName reads the volume name from the request body and puts the body
+// back for the next handler.
+func volumeName(req *http.Request) (string, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return "", err
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	var named struct {
+		Name string
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &named); err != nil {
+			return "", err
+		}
+	}
+	return named.Name, nil
+}
+
+func writeErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	body, _ := json.Marshal(dockerdriver.ErrorResponse{Err: message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header         { return r.header }
+func (r *responseRecorder) Write(b []byte) (int, error) { return r.body.Write(b) }
+func (r *responseRecorder) WriteHeader(status int)      { r.status = status }
@@ -0,0 +1,254 @@
+package authorization_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/localdriver/authorization"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeDriverHandler struct {
+	paths  []string
+	bodies []string
+}
+
+func (f *fakeDriverHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	f.paths = append(f.paths, req.URL.Path)
+	f.bodies = append(f.bodies, string(body))
+
+	if req.URL.Path == "/VolumeDriver.List" {
+		json.NewEncoder(w).Encode(dockerdriver.ListResponse{Volumes: []dockerdriver.VolumeInfo{
+			{Name: "app-one"},
+			{Name: "db-one"},
+			{Name: "app-two"},
+		}})
+		return
+	}
+	json.NewEncoder(w).Encode(dockerdriver.ErrorResponse{})
+}
+
+var _ = Describe("Authorization Handler", func() {
+	var (
+		logger   *lagertest.TestLogger
+		next     *fakeDriverHandler
+		handler  http.Handler
+		recorder *httptest.ResponseRecorder
+		policies []authorization.Policy
+		cert     *x509.Certificate
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("authorization")
+		next = &fakeDriverHandler{}
+		recorder = httptest.NewRecorder()
+		cert = &x509.Certificate{Subject: pkix.Name{CommonName: "reader"}, DNSNames: []string{"cell-1.apps.internal"}}
+		policies = []authorization.Policy{
+			{
+				Name:       "readers",
+				Subjects:   []string{"CN=reader"},
+				Operations: []string{authorization.OperationList, authorization.OperationGet, authorization.OperationPath},
+			},
+			{
+				Name:       "cells",
+				Subjects:   []string{"DNS=*.apps.internal"},
+				Operations: []string{authorization.OperationMount, authorization.OperationUnmount, authorization.OperationList},
+				Volumes:    []string{"app-*"},
+			},
+		}
+	})
+
+	JustBeforeEach(func() {
+		handler = authorization.NewHandler(logger, policies, next)
+	})
+
+	request := func(route, body string) {
+		req := httptest.NewRequest("POST", route, strings.NewReader(body))
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		}
+		handler.ServeHTTP(recorder, req)
+	}
+
+	errorResponse := func() dockerdriver.ErrorResponse {
+		var response dockerdriver.ErrorResponse
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+		return response
+	}
+
+	It("passes allowed requests on with their body intact", func() {
+		request("/VolumeDriver.Get", `{"Name":"db-one"}`)
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(next.paths).To(Equal([]string{"/VolumeDriver.Get"}))
+		Expect(next.bodies).To(Equal([]string{`{"Name":"db-one"}`}))
+	})
+
+	It("denies operations no policy allows and audits them", func() {
+		request("/VolumeDriver.Remove", `{"Name":"db-one"}`)
+
+		Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		Expect(errorResponse().Err).To(Equal("client is not authorized to remove volumes"))
+		Expect(next.paths).To(BeEmpty())
+		Expect(logger.LogMessages()).To(ContainElement("authorization.audit.denied"))
+	})
+
+	It("denies volumes outside the patterns of the allowing policies", func() {
+		request("/VolumeDriver.Mount", `{"Name":"db-one"}`)
+
+		Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		Expect(errorResponse().Err).To(Equal("client is not authorized to mount volume 'db-one'"))
+		Expect(next.paths).To(BeEmpty())
+	})
+
+	It("allows volumes matching the patterns of the allowing policies", func() {
+		request("/VolumeDriver.Mount", `{"Name":"app-one"}`)
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(next.paths).To(Equal([]string{"/VolumeDriver.Mount"}))
+	})
+
+	It("allows a lease heartbeat for volumes the client may mount", func() {
+		request("/VolumeDriver.Heartbeat", `{"Name":"app-one","ID":"container-1"}`)
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(next.paths).To(Equal([]string{"/VolumeDriver.Heartbeat"}))
+	})
+
+	It("denies a lease heartbeat for volumes the client may not mount", func() {
+		request("/VolumeDriver.Heartbeat", `{"Name":"db-one","ID":"container-1"}`)
+
+		Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		Expect(errorResponse().Err).To(Equal("client is not authorized to mount volume 'db-one'"))
+		Expect(next.paths).To(BeEmpty())
+	})
+
+	It("always allows activation and capabilities", func() {
+		cert = nil
+		request("/Plugin.Activate", "")
+		request("/VolumeDriver.Capabilities", "")
+
+		Expect(next.paths).To(Equal([]string{"/Plugin.Activate", "/VolumeDriver.Capabilities"}))
+	})
+
+	Context("when listing", func() {
+		It("returns every volume one of the policies allows", func() {
+			request("/VolumeDriver.List", "")
+
+			var response dockerdriver.ListResponse
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.Volumes).To(HaveLen(3))
+		})
+
+		Context("when the policies only allow some volumes", func() {
+			BeforeEach(func() {
+				cert = &x509.Certificate{DNSNames: []string{"cell-1.apps.internal"}}
+			})
+
+			It("filters the rest out", func() {
+				request("/VolumeDriver.List", "")
+
+				var response dockerdriver.ListResponse
+				Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+				Expect(response.Volumes).To(Equal([]dockerdriver.VolumeInfo{{Name: "app-one"}, {Name: "app-two"}}))
+			})
+		})
+	})
+
+	Context("when the client has no certificate", func() {
+		BeforeEach(func() {
+			cert = nil
+		})
+
+		It("denies the request", func() {
+			request("/VolumeDriver.Get", `{"Name":"db-one"}`)
+
+			Expect(recorder.Code).To(Equal(http.StatusForbidden))
+			Expect(errorResponse().Err).To(Equal("a client certificate is required"))
+			Expect(next.paths).To(BeEmpty())
+		})
+	})
+
+	Context("when the certificate matches no policy", func() {
+		BeforeEach(func() {
+			cert = &x509.Certificate{Subject: pkix.Name{CommonName: "stranger"}}
+		})
+
+		It("denies the request", func() {
+			request("/VolumeDriver.List", "")
+
+			Expect(recorder.Code).To(Equal(http.StatusForbidden))
+			Expect(next.paths).To(BeEmpty())
+		})
+	})
+})
+
+var _ = Describe("Admin Handler", func() {
+	var (
+		next     *fakeDriverHandler
+		handler  http.Handler
+		recorder *httptest.ResponseRecorder
+		cert     *x509.Certificate
+	)
+
+	BeforeEach(func() {
+		next = &fakeDriverHandler{}
+		recorder = httptest.NewRecorder()
+		cert = &x509.Certificate{Subject: pkix.Name{CommonName: "operator"}}
+		handler = authorization.NewAdminHandler(lagertest.NewTestLogger("authorization"), []authorization.Policy{
+			{Name: "operators", Subjects: []string{"CN=operator"}, Operations: []string{authorization.OperationAdmin}},
+			{Name: "cells", Subjects: []string{"CN=cell"}, Operations: []string{authorization.AnyOperation}},
+			{Name: "app-operators", Subjects: []string{"CN=app-operator"}, Operations: []string{authorization.OperationAdmin}, Volumes: []string{"app-*"}},
+		}, next)
+	})
+
+	request := func() {
+		req := httptest.NewRequest("POST", "/volumes/app-one/move", strings.NewReader(`{"pool":"fast"}`))
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		}
+		handler.ServeHTTP(recorder, req)
+	}
+
+	It("passes requests from clients granted the admin operation on", func() {
+		request()
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(next.paths).To(Equal([]string{"/volumes/app-one/move"}))
+		Expect(next.bodies).To(Equal([]string{`{"pool":"fast"}`}))
+	})
+
+	DescribeTable("denies other clients",
+		func(commonName, message string) {
+			cert = &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+			request()
+
+			Expect(recorder.Code).To(Equal(http.StatusForbidden))
+			var response dockerdriver.ErrorResponse
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.Err).To(Equal(message))
+			Expect(next.paths).To(BeEmpty())
+		},
+		Entry("allowed every volume operation", "cell", "client is not authorized to use the admin API"),
+		Entry("allowed the admin operation on some volumes only", "app-operator", "client is not authorized to use the admin API"),
+		Entry("matching no policy", "stranger", "client is not authorized to use the admin API"),
+	)
+
+	It("requires a client certificate", func() {
+		cert = nil
+		request()
+
+		Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		Expect(next.paths).To(BeEmpty())
+	})
+})
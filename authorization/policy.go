@@ -0,0 +1,150 @@
+package authorization
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	OperationCreate  = "create"
+	OperationRemove  = "remove"
+	OperationMount   = "mount"
+	OperationUnmount = "unmount"
+	OperationGet     = "get"
+	OperationPath    = "path"
+	OperationList    = "list"
+	// OperationAdmin allows the admin API, which reaches every volume. It is
+	// only granted by policies that name it and are not limited to some
+	// volumes.
+	OperationAdmin = "admin"
+
+	// AnyOperation in a policy allows every operation.
+	AnyOperation = "*"
+)
+
+var operations = map[string]bool{
+	OperationCreate:  true,
+	OperationRemove:  true,
+	OperationMount:   true,
+	OperationUnmount: true,
+	OperationGet:     true,
+	OperationPath:    true,
+	OperationList:    true,
+	OperationAdmin:   true,
+	AnyOperation:     true,
+}
+
+// Policy grants the clients whose certificate matches one of Subjects the
+// listed Operations on the volumes whose names match one of Volumes. Subject
+// patterns are matched against the identities of the client certificate,
+// written as CN=<common name>, DNS=<name>, URI=<uri>, IP=<address> or
+// EMAIL=<address>. An empty Volumes list matches every volume.
+type Policy struct {
+	Name       string   `yaml:"name" json:"name"`
+	Subjects   []string `yaml:"subjects" json:"subjects"`
+	Operations []string `yaml:"operations" json:"operations"`
+	Volumes    []string `yaml:"volumes" json:"volumes"`
+}
+
+type policyFile struct {
+	Policies []Policy `yaml:"policies"`
+}
+
+// LoadPolicies reads a YAML or JSON policy file.
+func LoadPolicies(filename string) ([]Policy, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var file policyFile
+	if err := yaml.Unmarshal(contents, &file); err != nil {
+		return nil, err
+	}
+	if err := ValidatePolicies(file.Policies); err != nil {
+		return nil, err
+	}
+	return file.Policies, nil
+}
+
+// ValidatePolicies reports the first field of the policies that is missing
+// or malformed.
+func ValidatePolicies(policies []Policy) error {
+	if len(policies) == 0 {
+		return fmt.Errorf("policies: at least one policy is required")
+	}
+
+	for i, policy := range policies {
+		field := fmt.Sprintf("policies[%d]", i)
+		if len(policy.Subjects) == 0 {
+			return fmt.Errorf("%s.subjects: at least one subject is required", field)
+		}
+		if len(policy.Operations) == 0 {
+			return fmt.Errorf("%s.operations: at least one operation is required", field)
+		}
+
+		for j, subject := range policy.Subjects {
+			if _, err := path.Match(subject, ""); err != nil {
+				return fmt.Errorf("%s.subjects[%d]: invalid pattern '%s'", field, j, subject)
+			}
+		}
+		for j, operation := range policy.Operations {
+			if !operations[operation] {
+				return fmt.Errorf("%s.operations[%d]: unknown operation '%s'", field, j, operation)
+			}
+		}
+		for j, volume := range policy.Volumes {
+			if _, err := path.Match(volume, ""); err != nil {
+				return fmt.Errorf("%s.volumes[%d]: invalid pattern '%s'", field, j, volume)
+			}
+		}
+	}
+	return nil
+}
+
+func (p Policy) matchesClient(identities []string) bool {
+	for _, subject := range p.Subjects {
+		for _, identity := range identities {
+			if matched, _ := path.Match(subject, identity); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p Policy) allowsOperation(operation string) bool {
+	for _, allowed := range p.Operations {
+		if allowed == AnyOperation || allowed == operation {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Policy) allowsAdmin() bool {
+	if len(p.Volumes) > 0 {
+		return false
+	}
+	for _, allowed := range p.Operations {
+		if allowed == OperationAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Policy) allowsVolume(name string) bool {
+	if len(p.Volumes) == 0 {
+		return true
+	}
+	for _, pattern := range p.Volumes {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
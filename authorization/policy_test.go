@@ -0,0 +1,58 @@
+package authorization_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/localdriver/authorization"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Policies", func() {
+	var (
+		dir      string
+		filename string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "policies")
+		Expect(err).NotTo(HaveOccurred())
+		filename = filepath.Join(dir, "policies.yml")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("loads policies from YAML", func() {
+		Expect(os.WriteFile(filename, []byte(`
+policies:
+- name: readers
+  subjects: ["CN=monitoring"]
+  operations: [list, get, path]
+- name: cells
+  subjects: ["DNS=*.apps.internal"]
+  operations: ["*"]
+  volumes: ["app-*"]
+`), 0644)).To(Succeed())
+
+		policies, err := authorization.LoadPolicies(filename)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policies).To(Equal([]authorization.Policy{
+			{Name: "readers", Subjects: []string{"CN=monitoring"}, Operations: []string{"list", "get", "path"}},
+			{Name: "cells", Subjects: []string{"DNS=*.apps.internal"}, Operations: []string{"*"}, Volumes: []string{"app-*"}},
+		}))
+	})
+
+	DescribeTable("rejects invalid policies naming the field",
+		func(policies []authorization.Policy, message string) {
+			Expect(authorization.ValidatePolicies(policies)).To(MatchError(message))
+		},
+		Entry("no policies", nil, "policies: at least one policy is required"),
+		Entry("no subjects", []authorization.Policy{{Operations: []string{"list"}}}, "policies[0].subjects: at least one subject is required"),
+		Entry("an unknown operation", []authorization.Policy{{Subjects: []string{"CN=a"}, Operations: []string{"list", "delete"}}}, "policies[0].operations[1]: unknown operation 'delete'"),
+		Entry("a bad volume pattern", []authorization.Policy{{Subjects: []string{"CN=a"}, Operations: []string{"list"}, Volumes: []string{"app-["}}}, "policies[0].volumes[0]: invalid pattern 'app-['"),
+	)
+})
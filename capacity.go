@@ -0,0 +1,96 @@
+package localdriver
+
+import (
+	"fmt"
+	"os"
+
+	"code.cloudfoundry.org/bytefmt"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// PoolCapacity is what statfs reports for the filesystem a pool lives on.
+// Capacity is the pool's own limit, if it has one, and BelowMinimum tells
+// whether Create currently refuses the pool for lack of free space or inodes.
+type PoolCapacity struct {
+	Name         string `json:"name"`
+	TotalBytes   uint64 `json:"total_bytes"`
+	FreeBytes    uint64 `json:"free_bytes"`
+	TotalInodes  uint64 `json:"total_inodes"`
+	FreeInodes   uint64 `json:"free_inodes"`
+	Capacity     uint64 `json:"capacity,omitempty"`
+	BelowMinimum bool   `json:"below_minimum"`
+	Err          string `json:"error,omitempty"`
+}
+
+// poolStats runs statfs on the pool, or on its nearest parent while the pool
+// directory has not been created yet.
+func (d *LocalDriver) poolStats(pool *Pool) (FilesystemStats, error) {
+	path := pool.Path
+	for {
+		stats, err := d.osHelper.Statfs(path)
+		if !os.IsNotExist(err) || d.filepath.Dir(path) == path {
+			return stats, err
+		}
+		path = d.filepath.Dir(path)
+	}
+}
+
+// checkFreeThresholds fails when the pool's filesystem has less free space or
+// fewer free inodes than the driver is configured to keep.
+func (d *LocalDriver) checkFreeThresholds(pool *Pool) error {
+	if d.minFreeBytes == 0 && d.minFreeInodes == 0 {
+		return nil
+	}
+
+	stats, err := d.poolStats(pool)
+	if err != nil {
+		return fmt.Errorf("Failed checking free space in pool '%s': %s", pool.Name, err)
+	}
+	return d.belowThresholds(pool, stats)
+}
+
+func (d *LocalDriver) belowThresholds(pool *Pool, stats FilesystemStats) error {
+	if stats.FreeBytes < d.minFreeBytes {
+		return fmt.Errorf("Pool '%s' has %s free, less than the minimum of %s", pool.Name, bytefmt.ByteSize(stats.FreeBytes), bytefmt.ByteSize(d.minFreeBytes))
+	}
+	// some filesystems do not count inodes and report none at all
+	if stats.TotalInodes > 0 && stats.FreeInodes < d.minFreeInodes {
+		return fmt.Errorf("Pool '%s' has %d free inodes, less than the minimum of %d", pool.Name, stats.FreeInodes, d.minFreeInodes)
+	}
+	return nil
+}
+
+func (d *LocalDriver) poolCapacity(pool *Pool) PoolCapacity {
+	capacity := PoolCapacity{Name: pool.Name, Capacity: pool.Capacity}
+	stats, err := d.poolStats(pool)
+	if err != nil {
+		capacity.Err = err.Error()
+		return capacity
+	}
+
+	capacity.TotalBytes = stats.TotalBytes
+	capacity.FreeBytes = stats.FreeBytes
+	capacity.TotalInodes = stats.TotalInodes
+	capacity.FreeInodes = stats.FreeInodes
+	capacity.BelowMinimum = d.belowThresholds(pool, stats) != nil
+	return capacity
+}
+
+// PoolCapacities reports the capacity of every pool, in the order the pools
+// are configured.
+func (d *LocalDriver) PoolCapacities(env dockerdriver.Env) []PoolCapacity {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	logger := env.Logger().Session("pool-capacities")
+	capacities := make([]PoolCapacity, 0, len(d.pools))
+	for i := range d.pools {
+		capacity := d.poolCapacity(&d.pools[i])
+		if capacity.Err != "" {
+			logger.Info("failed-statfs-pool", lager.Data{"pool": capacity.Name, "error": capacity.Err})
+		}
+		capacities = append(capacities, capacity)
+	}
+	return capacities
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/bytefmt"
+	"code.cloudfoundry.org/localdriver"
+	"gopkg.in/yaml.v3"
+)
+
+var configFile = flag.String(
+	"config",
+	"",
+	"path to a YAML or JSON file with driver settings; flags given on the command line override the file",
+)
+
+// configFlags maps each setting in the config file to the flag it stands in
+// for. Nested settings are written as section.key.
+var configFlags = map[string]string{
+	"listen_addr":                          "listenAddr",
+	"advertise_addr":                       "advertiseAddr",
+	"transport":                            "transport",
+	"drivers_path":                         "driversPath",
+	"mount_dir":                            "mountDir",
+	"pools":                                "pools",
+	"placement":                            "placement",
+	"unique_volume_ids":                    "uniqueVolumeIds",
+	"admin_addr":                           "adminAddr",
+	"debug_addr":                           "debugAddr",
+	"reap_interval":                        "reapInterval",
+	"trash_retention":                      "trashRetention",
+	"idempotency_window":                   "idempotencyWindow",
+	"memory_dir":                           "memoryDir",
+	"max_memory_volume_size":               "maxMemoryVolumeSize",
+	"min_free_space":                       "minFreeSpace",
+	"min_free_inodes":                      "minFreeInodes",
+	"shutdown_timeout":                     "shutdownTimeout",
+	"socket.mode":                          "socketMode",
+	"socket.group":                         "socketGroup",
+	"tls.require":                          "requireSSL",
+	"tls.cert_file":                        "certFile",
+	"tls.key_file":                         "keyFile",
+	"tls.ca_file":                          "caFile",
+	"tls.client_cert_file":                 "clientCertFile",
+	"tls.client_key_file":                  "clientKeyFile",
+	"tls.insecure_skip_verify":             "insecureSkipVerify",
+	"tls.authorization_policies":           "authorizationPolicies",
+	"logging.level":                        "logLevel",
+	"rate_limit.global":                    "globalRateLimit",
+	"rate_limit.global_burst":              "globalRateBurst",
+	"rate_limit.client":                    "clientRateLimit",
+	"rate_limit.client_burst":              "clientRateBurst",
+	"rate_limit.max_concurrent_operations": "maxConcurrentOperations",
+}
+
+var configSections = map[string]bool{
+	"socket":     true,
+	"tls":        true,
+	"logging":    true,
+	"rate_limit": true,
+}
+
+// configValidators check settings whose flags accept any string, so that a
+// bad value is reported against the config field rather than failing later.
+var configValidators = map[string]func(string) error{
+	"transport": func(value string) error {
+		switch value {
+		case "tcp", "tcp-json", "unix", "unix-json":
+			return nil
+		}
+		return fmt.Errorf("invalid transport '%s': expected tcp, tcp-json, unix or unix-json", value)
+	},
+	"placement": func(value string) error {
+		if !localdriver.ValidPlacementPolicy(localdriver.PlacementPolicy(value)) {
+			return fmt.Errorf("invalid placement policy '%s'", value)
+		}
+		return nil
+	},
+	"max_memory_volume_size": func(value string) error {
+		_, err := bytefmt.ToBytes(value)
+		return err
+	},
+	"min_free_space": func(value string) error {
+		_, err := bytefmt.ToBytes(value)
+		return err
+	},
+	"socket.mode": func(value string) error {
+		_, _, err := socketPermissions(value, "")
+		return err
+	},
+	"logging.level": func(value string) error {
+		switch value {
+		case "debug", "info", "error", "fatal":
+			return nil
+		}
+		return fmt.Errorf("invalid log level '%s': expected debug, info, error or fatal", value)
+	},
+}
+
+type configSetting struct {
+	field string
+	flag  string
+	value string
+	node  *yaml.Node
+}
+
+// explicitFlags returns the names of the flags given on the command line.
+func explicitFlags(flagSet *flag.FlagSet) map[string]bool {
+	explicit := map[string]bool{}
+	flagSet.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	return explicit
+}
+
+// applyConfigFile sets the flags named in the config file at path, skipping
+// the explicit ones given on the command line.
+func applyConfigFile(flagSet *flag.FlagSet, path string, explicit map[string]bool) error {
+	settings, err := loadConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	for _, setting := range settings {
+		if explicit[setting.flag] {
+			continue
+		}
+		if err := flagSet.Set(setting.flag, setting.value); err != nil {
+			return fieldError(setting.field, setting.node, "invalid value '%s': %s", setting.value, err)
+		}
+	}
+	return nil
+}
+
+// loadConfigFile reads a YAML config file. JSON is valid YAML, so JSON files
+// are read the same way.
+func loadConfigFile(path string) ([]configSetting, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(contents, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+
+	var settings []configSetting
+	err = flattenConfig("", document.Content[0], &settings)
+	return settings, err
+}
+
+func flattenConfig(prefix string, node *yaml.Node, settings *[]configSetting) error {
+	if node.Kind != yaml.MappingNode {
+		name := prefix
+		if name == "" {
+			name = "config"
+		}
+		return fieldError(name, node, "expected a mapping")
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		field := key.Value
+		if prefix != "" {
+			field = prefix + "." + key.Value
+		}
+
+		if value.Tag == "!!null" {
+			continue
+		}
+		if configSections[field] {
+			if err := flattenConfig(field, value, settings); err != nil {
+				return err
+			}
+			continue
+		}
+
+		flagName, ok := configFlags[field]
+		if !ok {
+			return fieldError(field, key, "unknown setting")
+		}
+
+		var settingValue string
+		var err error
+		switch field {
+		case "pools":
+			settingValue, err = poolsFromConfig(field, value)
+		case "advertise_addr":
+			settingValue, err = listFromConfig(field, value)
+		default:
+			settingValue, err = scalarFromConfig(field, value)
+		}
+		if err != nil {
+			return err
+		}
+
+		if validate, ok := configValidators[field]; ok {
+			if err := validate(settingValue); err != nil {
+				return fieldError(field, value, "%s", err)
+			}
+		}
+
+		*settings = append(*settings, configSetting{field: field, flag: flagName, value: settingValue, node: value})
+	}
+	return nil
+}
+
+func scalarFromConfig(field string, node *yaml.Node) (string, error) {
+	if node.Kind != yaml.ScalarNode {
+		return "", fieldError(field, node, "expected a single value")
+	}
+	return node.Value, nil
+}
+
+// listFromConfig accepts either a single value or a list of values and joins
+// them the way the comma separated flags expect.
+func listFromConfig(field string, node *yaml.Node) (string, error) {
+	if node.Kind != yaml.SequenceNode {
+		return scalarFromConfig(field, node)
+	}
+
+	var values []string
+	for i, item := range node.Content {
+		value, err := scalarFromConfig(fmt.Sprintf("%s[%d]", field, i), item)
+		if err != nil {
+			return "", err
+		}
+		values = append(values, value)
+	}
+	return strings.Join(values, ","), nil
+}
+
+// poolsFromConfig turns a list of {name, path, capacity} mappings into the
+// name:path[:capacity] list that -pools takes.
+func poolsFromConfig(field string, node *yaml.Node) (string, error) {
+	if node.Kind != yaml.SequenceNode {
+		return "", fieldError(field, node, "expected a list of pools")
+	}
+
+	seen := map[string]bool{localdriver.DefaultPoolName: true}
+	var entries []string
+	for i, item := range node.Content {
+		poolField := fmt.Sprintf("%s[%d]", field, i)
+		if item.Kind != yaml.MappingNode {
+			return "", fieldError(poolField, item, "expected a mapping with name, path and capacity")
+		}
+
+		pool := map[string]string{}
+		for j := 0; j+1 < len(item.Content); j += 2 {
+			key, value := item.Content[j], item.Content[j+1]
+			keyField := poolField + "." + key.Value
+			switch key.Value {
+			case "name", "path", "capacity":
+			default:
+				return "", fieldError(keyField, key, "unknown setting")
+			}
+
+			v, err := scalarFromConfig(keyField, value)
+			if err != nil {
+				return "", err
+			}
+			if strings.ContainsAny(v, ",:") {
+				return "", fieldError(keyField, value, "must not contain ',' or ':'")
+			}
+			pool[key.Value] = v
+		}
+
+		for _, required := range []string{"name", "path"} {
+			if pool[required] == "" {
+				return "", fieldError(poolField+"."+required, item, "is required")
+			}
+		}
+		if seen[pool["name"]] {
+			return "", fieldError(poolField+".name", item, "duplicate pool name '%s'", pool["name"])
+		}
+		seen[pool["name"]] = true
+
+		entry := pool["name"] + ":" + pool["path"]
+		if capacity := pool["capacity"]; capacity != "" {
+			if _, err := bytefmt.ToBytes(capacity); err != nil {
+				return "", fieldError(poolField+".capacity", item, "%s", err)
+			}
+			entry += ":" + capacity
+		}
+		entries = append(entries, entry)
+	}
+	return strings.Join(entries, ","), nil
+}
+
+func fieldError(field string, node *yaml.Node, format string, args ...interface{}) error {
+	return fmt.Errorf("%s (line %d): %s", field, node.Line, fmt.Sprintf(format, args...))
+}
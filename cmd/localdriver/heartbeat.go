@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/localdriver"
+)
+
+// heartbeatRoute renews a mount lease. It is served next to the volume plugin
+// routes, so that the container holding the lease renews it over the same
+// connection and with the same authorization as its mount.
+const heartbeatRoute = "/VolumeDriver.Heartbeat"
+
+type heartbeater interface {
+	Heartbeat(env dockerdriver.Env, heartbeatRequest localdriver.HeartbeatRequest) dockerdriver.ErrorResponse
+}
+
+// withHeartbeat serves heartbeatRoute, whose body names the volume and, like
+// a Mount, carries the ID of the holder, and passes every other request on to
+// next.
+func withHeartbeat(logger lager.Logger, driver heartbeater, next http.Handler) http.Handler {
+	logger = logger.Session("handle-heartbeat")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != heartbeatRoute {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		var request struct {
+			Name string
+			ID   string
+		}
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			logger.Error("failed-parsing-heartbeat-request-body", err)
+			writeHeartbeatResponse(w, http.StatusBadRequest, dockerdriver.ErrorResponse{Err: err.Error()})
+			return
+		}
+
+		env := driverhttp.NewHttpDriverEnv(logger, req.Context())
+		response := driver.Heartbeat(env, localdriver.HeartbeatRequest{Name: request.Name, Holder: request.ID})
+		if response.Err != "" {
+			writeHeartbeatResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+		writeHeartbeatResponse(w, http.StatusOK, response)
+	})
+}
+
+func writeHeartbeatResponse(w http.ResponseWriter, statusCode int, response dockerdriver.ErrorResponse) {
+	body, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"flag"
+	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"code.cloudfoundry.org/bytefmt"
+	"code.cloudfoundry.org/clock"
 	cf_debug_server "code.cloudfoundry.org/debugserver"
 	"code.cloudfoundry.org/tlsconfig"
 
@@ -16,7 +23,11 @@ import (
 	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/lager/v3/lagerflags"
 	"code.cloudfoundry.org/localdriver"
+	"code.cloudfoundry.org/localdriver/admin"
+	"code.cloudfoundry.org/localdriver/authorization"
 	"code.cloudfoundry.org/localdriver/oshelper"
+	"code.cloudfoundry.org/localdriver/ratelimit"
+	"code.cloudfoundry.org/localdriver/reaper"
 	"github.com/tedsuo/ifrit"
 	"github.com/tedsuo/ifrit/grouper"
 	"github.com/tedsuo/ifrit/http_server"
@@ -29,6 +40,12 @@ var atAddress = flag.String(
 	"host:port to serve volume management functions",
 )
 
+var advertiseAddr = flag.String(
+	"advertiseAddr",
+	"",
+	"host:port address written to the driver spec for clients to dial (defaults to listenAddr); the JSON transports accept a comma separated list, of which clients dial the first",
+)
+
 var driversPath = flag.String(
 	"driversPath",
 	"",
@@ -38,7 +55,19 @@ var driversPath = flag.String(
 var transport = flag.String(
 	"transport",
 	"tcp",
-	"Transport protocol to transmit HTTP over",
+	"Transport protocol to transmit HTTP over: tcp, tcp-json, unix or unix-json",
+)
+
+var socketMode = flag.String(
+	"socketMode",
+	"",
+	"octal file mode to set on the unix socket, e.g. 0660 (unix transport only)",
+)
+
+var socketGroup = flag.String(
+	"socketGroup",
+	"",
+	"group name or id to own the unix socket (unix transport only)",
 )
 
 var mountDir = flag.String(
@@ -47,6 +76,66 @@ var mountDir = flag.String(
 	"Path to directory where local volumes are created",
 )
 
+var pools = flag.String(
+	"pools",
+	"",
+	"Comma separated list of additional storage pools, each given as name:path[:capacity] (e.g. fast:/mnt/ssd:10G)",
+)
+
+var placement = flag.String(
+	"placement",
+	"",
+	"Policy used to choose a pool for volumes created without a 'pool' option: most-free-space or round-robin (default: first pool with room)",
+)
+
+var adminAddr = flag.String(
+	"adminAddr",
+	"",
+	"host:port to serve the volume administration API on (disabled when empty); addresses other than loopback require -requireSSL",
+)
+
+var reapInterval = flag.Duration(
+	"reapInterval",
+	time.Minute,
+	"how often to release expired mount leases and remove volumes whose ttl has passed (0 disables the reaper and the lease mount option)",
+)
+
+var trashRetention = flag.Duration(
+	"trashRetention",
+	0,
+	"keep removed volumes in the pool's _trash directory for this long so they can be restored (0 removes volumes immediately; requires the reaper)",
+)
+
+var memoryDir = flag.String(
+	"memoryDir",
+	localdriver.DefaultSharedMemoryDir,
+	"directory holding volumes created with medium 'memory' where tmpfs cannot be mounted",
+)
+
+var maxMemoryVolumeSize = flag.String(
+	"maxMemoryVolumeSize",
+	"64M",
+	"largest size of a volume created with medium 'memory', and the size of those that do not ask for one",
+)
+
+var minFreeSpace = flag.String(
+	"minFreeSpace",
+	"",
+	"refuse to create volumes in a pool whose filesystem has less free space than this, e.g. 1G (disabled when empty)",
+)
+
+var minFreeInodes = flag.Uint64(
+	"minFreeInodes",
+	0,
+	"refuse to create volumes in a pool whose filesystem has fewer free inodes than this (0 disables the check)",
+)
+
+var shutdownTimeout = flag.Duration(
+	"shutdownTimeout",
+	30*time.Second,
+	"how long to wait for in-flight requests to finish when shutting down",
+)
+
 var requireSSL = flag.Bool(
 	"requireSSL",
 	false,
@@ -88,38 +177,94 @@ var insecureSkipVerify = flag.Bool(
 	"whether SSL communication should skip verification of server IP addresses in the certificate",
 )
 
+var authorizationPolicies = flag.String(
+	"authorizationPolicies",
+	"",
+	"path to a YAML or JSON file of policies mapping client certificates to allowed operations and volumes (requires -requireSSL)",
+)
+
+var globalRateLimit = flag.Float64(
+	"globalRateLimit",
+	0,
+	"requests per second the driver accepts across all clients (0 is unlimited)",
+)
+
+var globalRateBurst = flag.Int(
+	"globalRateBurst",
+	0,
+	"requests the driver accepts in a burst across all clients (defaults to one second's worth)",
+)
+
+var clientRateLimit = flag.Float64(
+	"clientRateLimit",
+	0,
+	"requests per second the driver accepts from each client (0 is unlimited)",
+)
+
+var clientRateBurst = flag.Int(
+	"clientRateBurst",
+	0,
+	"requests the driver accepts in a burst from each client (defaults to one second's worth)",
+)
+
+var maxConcurrentOperations = flag.Int(
+	"maxConcurrentOperations",
+	0,
+	"number of create, remove, mount and unmount calls allowed to run at once (0 is unlimited)",
+)
+
+var idempotencyWindow = flag.Duration(
+	"idempotencyWindow",
+	5*time.Minute,
+	"how long a mount or unmount with an idempotency key or container ID is remembered, so that a retry does not count twice (0 disables it)",
+)
+
 var uniqueVolumeIds = flag.Bool(
 	"uniqueVolumeIds",
 	false,
 	"whether the local driver should opt-in to unique volumes",
 )
 
+// commandLineFlags holds the flags given on the command line, which take
+// precedence over the config file when it is loaded or reloaded.
+var commandLineFlags map[string]bool
+
 func main() {
 	parseCommandLine()
 
-	var logger lager.Logger
-	var logTap *lager.ReconfigurableSink
+	logger, logTap := newLogger()
+	defer logger.Info("ends")
 
-	var localDriverServer ifrit.Runner
+	options, err := driverServerOptionsFromFlags(logger)
+	exitOnFailure(logger, err)
 
-	if *transport == "tcp" {
-		logger, logTap = newLogger()
-		defer logger.Info("ends")
-		localDriverServer = createLocalDriverServer(logger, *atAddress, *driversPath, *mountDir, false, false)
-	} else if *transport == "tcp-json" {
-		logger, logTap = newLogger()
-		defer logger.Info("ends")
-		localDriverServer = createLocalDriverServer(logger, *atAddress, *driversPath, *mountDir, true, *uniqueVolumeIds)
-	} else {
-		logger, logTap = newUnixLogger()
-		defer logger.Info("ends")
+	limits := rateLimitsFromFlags()
+	exitOnFailure(logger, limits.Validate())
+	limiter := ratelimit.NewLimiter(clock.NewClock(), limits)
 
-		localDriverServer = createLocalDriverUnixServer(logger, *atAddress, *driversPath, *mountDir)
+	shutdown := newGracefulShutdown(logger, *shutdownTimeout)
+	client := newLocalDriver(logger, *mountDir, options.uniqueVolumeIds)
+	policies := loadAuthorizationPolicies(logger)
+	localDriverServer, tlsReloader := createLocalDriverServer(logger, client, limiter, shutdown, policies, options)
+
+	var volumeReaper *reaper.Reaper
+	if *reapInterval > 0 {
+		volumeReaper = reaper.NewReaper(logger, client, clock.NewClock(), *reapInterval)
 	}
 
+	// the reloader goes first so that a SIGHUP sent as soon as the driver
+	// accepts connections is not taken as a request to exit
 	servers := grouper.Members{
+		{Name: "reloader", Runner: newReloader(logger, logTap, tlsReloader, volumeReaper, limiter)},
 		{Name: "localdriver-server", Runner: localDriverServer},
 	}
+	if volumeReaper != nil {
+		servers = append(servers, grouper.Member{Name: "reaper", Runner: volumeReaper})
+	}
+	if *adminAddr != "" {
+		servers = append(servers, grouper.Member{Name: "admin-server", Runner: createAdminServer(logger, client, limiter, shutdown, tlsReloader, policies, *adminAddr)})
+	}
+	servers = append(servers, grouper.Member{Name: "graceful-shutdown", Runner: shutdown})
 	if dbgAddr := cf_debug_server.DebugAddress(flag.CommandLine); dbgAddr != "" {
 		servers = append(grouper.Members{
 			{Name: "debug-server", Runner: cf_debug_server.Runner(dbgAddr, logTap)},
@@ -147,11 +292,101 @@ func processRunnerFor(servers grouper.Members) ifrit.Runner {
 	return sigmon.New(grouper.NewOrdered(os.Interrupt, servers))
 }
 
-func createLocalDriverServer(logger lager.Logger, atAddress, driversPath, mountDir string, jsonSpec bool, uniqueVolumeIds bool) ifrit.Runner {
-	advertisedUrl := "http://" + atAddress
-	logger.Info("writing-spec-file", lager.Data{"location": driversPath, "name": "localdriver", "address": advertisedUrl})
-	if jsonSpec {
-		driverJsonSpec := dockerdriver.DriverSpec{Name: "localdriver", Address: advertisedUrl, UniqueVolumeIds: uniqueVolumeIds}
+// driverServerOptions holds the settings shared by every transport. The
+// transport only decides whether we listen on tcp or on a unix socket and
+// whether the spec is written as plain text or as JSON.
+type driverServerOptions struct {
+	unix                bool
+	jsonSpec            bool
+	listenAddr          string
+	advertisedAddresses []string
+	driversPath         string
+	uniqueVolumeIds     bool
+}
+
+func driverServerOptionsFromFlags(logger lager.Logger) (driverServerOptions, error) {
+	options := driverServerOptions{
+		listenAddr:      *atAddress,
+		driversPath:     *driversPath,
+		uniqueVolumeIds: *uniqueVolumeIds,
+	}
+
+	switch *transport {
+	case "tcp":
+	case "tcp-json":
+		options.jsonSpec = true
+	case "unix":
+		options.unix = true
+	case "unix-json":
+		options.unix = true
+		options.jsonSpec = true
+	default:
+		return options, fmt.Errorf("invalid transport '%s': expected tcp, tcp-json, unix or unix-json", *transport)
+	}
+
+	// the plain transports have always ignored -uniqueVolumeIds, since a
+	// .spec file cannot advertise it to clients
+	if options.uniqueVolumeIds && !options.jsonSpec {
+		logger.Info("ignoring-unique-volume-ids", lager.Data{"transport": *transport, "hint": fmt.Sprintf("use -transport=%s-json to advertise unique volume IDs", *transport)})
+		options.uniqueVolumeIds = false
+	}
+	if options.unix && *requireSSL {
+		return options, fmt.Errorf("-requireSSL is not supported with the %s transport", *transport)
+	}
+	if *authorizationPolicies != "" && !*requireSSL {
+		return options, fmt.Errorf("-authorizationPolicies requires -requireSSL to identify clients")
+	}
+	if *adminAddr != "" && !*requireSSL && !loopbackAddress(*adminAddr) {
+		return options, fmt.Errorf("-adminAddr %s is not a loopback address, serving the admin API there requires -requireSSL", *adminAddr)
+	}
+
+	if options.unix {
+		socketPath, err := filepath.Abs(*atAddress)
+		if err != nil {
+			return options, err
+		}
+		options.listenAddr = socketPath
+		return options, nil
+	}
+
+	advertised, err := advertisedAddresses(logger, *atAddress, *advertiseAddr)
+	if err != nil {
+		return options, err
+	}
+	if len(advertised) > 1 && !options.jsonSpec {
+		return options, fmt.Errorf("-advertiseAddr can only list several addresses in a JSON spec, use -transport=%s-json", *transport)
+	}
+	options.advertisedAddresses = advertised
+	return options, nil
+}
+
+// createLocalDriverServer writes the driver spec and returns the server
+// runner, along with the TLS reloader when the server requires TLS.
+func createLocalDriverServer(logger lager.Logger, client *localdriver.LocalDriver, limiter *ratelimit.Limiter, shutdown *gracefulShutdown, policies []authorization.Policy, options driverServerOptions) (ifrit.Runner, *tlsReloader) {
+	var advertisedUrls []string
+	if options.unix {
+		err := removeStaleSocket(logger, options.listenAddr)
+		exitOnFailure(logger, err)
+		shutdown.removeOnShutdown(options.listenAddr)
+
+		advertisedUrls = []string{"unix://" + options.listenAddr}
+	} else {
+		scheme := "http://"
+		if options.jsonSpec && *requireSSL {
+			scheme = "https://"
+		}
+		for _, address := range options.advertisedAddresses {
+			advertisedUrls = append(advertisedUrls, scheme+address)
+		}
+	}
+	advertisedUrl := advertisedUrls[0]
+
+	logger.Info("writing-spec-file", lager.Data{"location": options.driversPath, "name": "localdriver", "address": advertisedUrl, "addresses": advertisedUrls})
+	if options.jsonSpec {
+		driverJsonSpec := driverSpec{DriverSpec: dockerdriver.DriverSpec{Name: "localdriver", Address: advertisedUrl, UniqueVolumeIds: options.uniqueVolumeIds}}
+		if len(advertisedUrls) > 1 {
+			driverJsonSpec.Addresses = advertisedUrls
+		}
 
 		if *requireSSL {
 			absCaFile, err := filepath.Abs(*caFile)
@@ -161,58 +396,224 @@ func createLocalDriverServer(logger lager.Logger, atAddress, driversPath, mountD
 			absClientKeyFile, err := filepath.Abs(*clientKeyFile)
 			exitOnFailure(logger, err)
 			driverJsonSpec.TLSConfig = &dockerdriver.TLSConfig{InsecureSkipVerify: *insecureSkipVerify, CAFile: absCaFile, CertFile: absClientCertFile, KeyFile: absClientKeyFile}
-			driverJsonSpec.Address = "https://" + atAddress
 		}
 
 		jsonBytes, err := json.Marshal(driverJsonSpec)
 
 		exitOnFailure(logger, err)
-		err = dockerdriver.WriteDriverSpec(logger, driversPath, "localdriver", "json", jsonBytes)
+		err = dockerdriver.WriteDriverSpec(logger, options.driversPath, "localdriver", "json", jsonBytes)
 		exitOnFailure(logger, err)
+		shutdown.removeOnShutdown(filepath.Join(options.driversPath, "localdriver.json"))
 	} else {
-		err := dockerdriver.WriteDriverSpec(logger, driversPath, "localdriver", "spec", []byte(advertisedUrl))
+		err := dockerdriver.WriteDriverSpec(logger, options.driversPath, "localdriver", "spec", []byte(advertisedUrl))
 		exitOnFailure(logger, err)
+		shutdown.removeOnShutdown(filepath.Join(options.driversPath, "localdriver.spec"))
 	}
 
-	client := localdriver.NewLocalDriver(&osshim.OsShim{}, &filepathshim.FilepathShim{}, mountDir, oshelper.NewOsHelper(), uniqueVolumeIds)
 	handler, err := driverhttp.NewHandler(logger, client)
 	exitOnFailure(logger, err)
+	handler = withHeartbeat(logger, client, handler)
+	handler = withRequestIDs(handler)
+	if policies != nil {
+		handler = authorization.NewHandler(logger, policies, handler)
+	}
+	handler = ratelimit.NewHandler(logger, limiter, handler)
+	handler = shutdown.wrap(handler)
+
+	if options.unix {
+		mode, gid, err := socketPermissions(*socketMode, *socketGroup)
+		exitOnFailure(logger, err)
+		return newSocketPermissionsRunner(logger, http_server.NewUnixServer(options.listenAddr, handler), options.listenAddr, mode, gid), nil
+	}
 
-	var server ifrit.Runner
 	if *requireSSL {
-		tlsConfig, err := tlsconfig.Build(
-			tlsconfig.WithInternalServiceDefaults(),
-			tlsconfig.WithIdentityFromFile(*certFile, *keyFile),
-		).Server(tlsconfig.WithClientAuthenticationFromFile(*caFile))
+		reloader, err := newTLSReloader(func() (*tls.Config, error) {
+			return tlsconfig.Build(
+				tlsconfig.WithInternalServiceDefaults(),
+				tlsconfig.WithIdentityFromFile(*certFile, *keyFile),
+			).Server(tlsconfig.WithClientAuthenticationFromFile(*caFile))
+		})
 		if err != nil {
 			logger.Fatal("tls-configuration-failed", err)
 		}
-		server = http_server.NewTLSServer(atAddress, handler, tlsConfig)
-	} else {
-		server = http_server.New(atAddress, handler)
+		return http_server.NewTLSServer(options.listenAddr, handler, reloader.serverConfig()), reloader
 	}
 
-	return server
+	return http_server.New(options.listenAddr, handler), nil
 }
 
-func createLocalDriverUnixServer(logger lager.Logger, atAddress, driversPath, mountDir string) ifrit.Runner {
-	client := localdriver.NewLocalDriver(&osshim.OsShim{}, &filepathshim.FilepathShim{}, mountDir, oshelper.NewOsHelper(), false)
-	handler, err := driverhttp.NewHandler(logger, client)
+// driverSpec is the JSON spec file format. Clients dial Addr, the first
+// advertised address; Addrs lists all of them for operators and tooling only,
+// since dockerdriver and volman do not read it.
+type driverSpec struct {
+	dockerdriver.DriverSpec
+	Addresses []string `json:"Addrs,omitempty"`
+}
+
+// advertisedAddresses returns the host:port addresses clients are told to
+// dial, falling back to the listen address when none are configured.
+func advertisedAddresses(logger lager.Logger, listenAddr, advertiseAddr string) ([]string, error) {
+	if advertiseAddr == "" {
+		host, _, err := net.SplitHostPort(listenAddr)
+		if err == nil && (host == "" || net.ParseIP(host).IsUnspecified()) {
+			logger.Info("advertising-unspecified-address", lager.Data{"address": listenAddr, "hint": "set -advertiseAddr to an address clients can dial"})
+		}
+		return []string{listenAddr}, nil
+	}
+
+	var addresses []string
+	for _, address := range strings.Split(advertiseAddr, ",") {
+		address = strings.TrimSpace(address)
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return nil, fmt.Errorf("invalid advertise address '%s': %s", address, err)
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+// loadAuthorizationPolicies returns the policies of -authorizationPolicies,
+// or nil when every client is allowed everything.
+func loadAuthorizationPolicies(logger lager.Logger) []authorization.Policy {
+	if *authorizationPolicies == "" {
+		return nil
+	}
+	policies, err := authorization.LoadPolicies(*authorizationPolicies)
+	if err != nil {
+		exitOnFailure(logger, fmt.Errorf("invalid authorization policies %s: %s", *authorizationPolicies, err))
+	}
+	logger.Info("authorizing-clients", lager.Data{"policies": len(policies)})
+	return policies
+}
+
+// createAdminServer serves the admin API with the TLS configuration of the
+// driver server, when it has one, and only to clients the policies grant the
+// admin operation.
+func createAdminServer(logger lager.Logger, client *localdriver.LocalDriver, limiter *ratelimit.Limiter, shutdown *gracefulShutdown, reloader *tlsReloader, policies []authorization.Policy, adminAddr string) ifrit.Runner {
+	logger.Info("serving-admin-api", lager.Data{"address": adminAddr, "tls": reloader != nil})
+	handler := admin.NewHandler(logger, client, limiter)
+	if policies != nil {
+		handler = authorization.NewAdminHandler(logger, policies, handler)
+	}
+	handler = shutdown.wrap(handler)
+
+	if reloader != nil {
+		return http_server.NewTLSServer(adminAddr, handler, reloader.serverConfig())
+	}
+	return http_server.New(adminAddr, handler)
+}
+
+// loopbackAddress tells whether a host:port address only accepts connections
+// from this host.
+func loopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func rateLimitsFromFlags() ratelimit.Limits {
+	return ratelimit.Limits{
+		GlobalRate:              *globalRateLimit,
+		GlobalBurst:             *globalRateBurst,
+		ClientRate:              *clientRateLimit,
+		ClientBurst:             *clientRateBurst,
+		MaxConcurrentOperations: *maxConcurrentOperations,
+	}
+}
+
+func newLocalDriver(logger lager.Logger, mountDir string, uniqueVolumeIds bool) *localdriver.LocalDriver {
+	driverPools, err := parsePools(mountDir, *pools)
+	exitOnFailure(logger, err)
+
+	// the trash is only purged by the reaper
+	if *trashRetention > 0 && *reapInterval <= 0 {
+		exitOnFailure(logger, fmt.Errorf("-trashRetention requires the reaper, set -reapInterval"))
+	}
+
+	memorySize, err := bytefmt.ToBytes(*maxMemoryVolumeSize)
+	if err != nil {
+		exitOnFailure(logger, fmt.Errorf("invalid max memory volume size '%s': %s", *maxMemoryVolumeSize, err))
+	}
+
+	var minFreeBytes uint64
+	if *minFreeSpace != "" {
+		minFreeBytes, err = bytefmt.ToBytes(*minFreeSpace)
+		if err != nil {
+			exitOnFailure(logger, fmt.Errorf("invalid min free space '%s': %s", *minFreeSpace, err))
+		}
+	}
+
+	config := localdriver.Config{
+		Pools:               driverPools,
+		Placement:           localdriver.PlacementPolicy(*placement),
+		UniqueVolumeIds:     uniqueVolumeIds,
+		TrashRetention:      *trashRetention,
+		Leases:              *reapInterval > 0,
+		IdempotencyWindow:   *idempotencyWindow,
+		SharedMemoryDir:     *memoryDir,
+		MaxMemoryVolumeSize: memorySize,
+		MinFreeBytes:        minFreeBytes,
+		MinFreeInodes:       *minFreeInodes,
+	}
+
+	driver, err := localdriver.NewLocalDriverWithConfig(map[string]*localdriver.LocalVolumeInfo{}, &osshim.OsShim{}, &filepathshim.FilepathShim{}, oshelper.NewOsHelper(), config)
 	exitOnFailure(logger, err)
-	return http_server.NewUnixServer(atAddress, handler)
+	return driver
 }
 
-func newLogger() (lager.Logger, *lager.ReconfigurableSink) {
-	return lagerflags.NewFromConfig("localdriver-server", lagerflags.ConfigFromFlags())
+func parsePools(mountDir, spec string) ([]localdriver.Pool, error) {
+	driverPools := []localdriver.Pool{{Name: localdriver.DefaultPoolName, Path: mountDir}}
+	if spec == "" {
+		return driverPools, nil
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid pool '%s': expected name:path[:capacity]", entry)
+		}
+
+		pool := localdriver.Pool{Name: parts[0], Path: parts[1]}
+		for _, existing := range driverPools {
+			if existing.Name == pool.Name {
+				return nil, fmt.Errorf("duplicate pool name '%s'", pool.Name)
+			}
+		}
+
+		if len(parts) == 3 {
+			capacity, err := bytefmt.ToBytes(parts[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid capacity for pool '%s': %s", pool.Name, err)
+			}
+			pool.Capacity = capacity
+		}
+
+		driverPools = append(driverPools, pool)
+	}
+
+	return driverPools, nil
 }
 
-func newUnixLogger() (lager.Logger, *lager.ReconfigurableSink) {
-	logger, reconfigurableSink := lagerflags.New("localdriver-server")
-	return logger, reconfigurableSink
+func newLogger() (lager.Logger, *lager.ReconfigurableSink) {
+	return lagerflags.NewFromConfig("localdriver-server", lagerflags.ConfigFromFlags())
 }
 
 func parseCommandLine() {
 	lagerflags.AddFlags(flag.CommandLine)
 	cf_debug_server.AddFlags(flag.CommandLine)
 	flag.Parse()
+
+	commandLineFlags = explicitFlags(flag.CommandLine)
+	if *configFile != "" {
+		if err := applyConfigFile(flag.CommandLine, *configFile, commandLineFlags); err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "invalid config file %s: %s\n", *configFile, err)
+			os.Exit(2)
+		}
+	}
 }
@@ -1,13 +1,22 @@
 package main_test
 
 import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"syscall"
+
+	"code.cloudfoundry.org/tlsconfig/certtest"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
 )
 
@@ -61,6 +70,24 @@ var _ = Describe("Main", func() {
 			}`))
 		})
 
+		Context("when terminated", func() {
+			It("removes the spec file and exits cleanly", func() {
+				specFile := filepath.Join(dir, "localdriver.json")
+				Eventually(func() error {
+					conn, err := net.Dial("tcp", "0.0.0.0:9750")
+					if err == nil {
+						conn.Close()
+					}
+					return err
+				}, 5).ShouldNot(HaveOccurred())
+				Expect(specFile).To(BeAnExistingFile())
+
+				session.Terminate()
+				Eventually(session, 5).Should(gexec.Exit(0))
+				Expect(specFile).NotTo(BeAnExistingFile())
+			})
+		})
+
 		Context("in another context", func() {
 			BeforeEach(func() {
 				command.Args = append(command.Args, "-listenAddr=0.0.0.0:9751")
@@ -74,6 +101,68 @@ var _ = Describe("Main", func() {
 			})
 		})
 
+		Context("with an advertise address", func() {
+			BeforeEach(func() {
+				command.Args = append(command.Args, "-advertiseAddr=127.0.0.1:9750")
+			})
+
+			It("writes the advertise address to the spec file", func() {
+				specFile := filepath.Join(dir, "localdriver.json")
+				Eventually(func() error {
+					_, err := os.Stat(specFile)
+					return err
+				}, 5).ShouldNot(HaveOccurred())
+
+				specFileContents, err := os.ReadFile(specFile)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(specFileContents)).To(MatchJSON(`{
+					"Name": "localdriver",
+					"Addr": "http://127.0.0.1:9750",
+					"TLSConfig": null,
+					"UniqueVolumeIds": false
+				}`))
+			})
+		})
+
+		Context("with several advertise addresses", func() {
+			BeforeEach(func() {
+				command.Args = append(command.Args, "-advertiseAddr=127.0.0.1:9750,localhost:9750")
+			})
+
+			It("writes all of them to the spec file", func() {
+				specFile := filepath.Join(dir, "localdriver.json")
+				Eventually(func() error {
+					_, err := os.Stat(specFile)
+					return err
+				}, 5).ShouldNot(HaveOccurred())
+
+				specFileContents, err := os.ReadFile(specFile)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(specFileContents)).To(MatchJSON(`{
+					"Name": "localdriver",
+					"Addr": "http://127.0.0.1:9750",
+					"Addrs": ["http://127.0.0.1:9750", "http://localhost:9750"],
+					"TLSConfig": null,
+					"UniqueVolumeIds": false
+				}`))
+			})
+		})
+
+		Context("with the plain spec format", func() {
+			BeforeEach(func() {
+				command.Args = append(command.Args, "-transport=tcp", "-advertiseAddr=127.0.0.1:9750,localhost:9750")
+			})
+
+			It("refuses to start with several advertise addresses", func() {
+				Eventually(session, 5).Should(gexec.Exit())
+				Expect(session.ExitCode()).NotTo(Equal(0))
+				Expect(string(session.Out.Contents())).To(ContainSubstring("-advertiseAddr can only list several addresses in a JSON spec, use -transport=tcp-json"))
+				Expect(filepath.Join(dir, "localdriver.spec")).NotTo(BeAnExistingFile())
+			})
+		})
+
 		Context("with unique volume IDs enabled", func() {
 			BeforeEach(func() {
 				command.Args = append(command.Args, "-uniqueVolumeIds")
@@ -98,4 +187,711 @@ var _ = Describe("Main", func() {
 			})
 		})
 	})
+
+	Context("with the unix transport", func() {
+		var (
+			dir        string
+			socketPath string
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "driversPath")
+			Expect(err).ToNot(HaveOccurred())
+			socketPath = filepath.Join(dir, "localdriver.sock")
+
+			command.Args = append(command.Args, "-driversPath="+dir)
+			command.Args = append(command.Args, "-transport=unix")
+			command.Args = append(command.Args, "-listenAddr="+socketPath)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("writes a spec file with the socket URL", func() {
+			Eventually(func() error {
+				conn, err := net.Dial("unix", socketPath)
+				if err == nil {
+					conn.Close()
+				}
+				return err
+			}, 5).ShouldNot(HaveOccurred())
+
+			specFileContents, err := os.ReadFile(filepath.Join(dir, "localdriver.spec"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(specFileContents)).To(Equal("unix://" + socketPath))
+		})
+
+		Context("when terminated", func() {
+			It("removes the spec file and the socket", func() {
+				specFile := filepath.Join(dir, "localdriver.spec")
+				Eventually(func() error {
+					conn, err := net.Dial("unix", socketPath)
+					if err == nil {
+						conn.Close()
+					}
+					return err
+				}, 5).ShouldNot(HaveOccurred())
+
+				session.Terminate()
+				Eventually(session, 5).Should(gexec.Exit(0))
+				Expect(specFile).NotTo(BeAnExistingFile())
+				Expect(socketPath).NotTo(BeAnExistingFile())
+			})
+		})
+
+		Context("when a stale socket is left over", func() {
+			BeforeEach(func() {
+				listener, err := net.Listen("unix", socketPath)
+				Expect(err).NotTo(HaveOccurred())
+				listener.(*net.UnixListener).SetUnlinkOnClose(false)
+				Expect(listener.Close()).To(Succeed())
+				Expect(socketPath).To(BeAnExistingFile())
+			})
+
+			It("replaces it", func() {
+				Eventually(func() error {
+					conn, err := net.Dial("unix", socketPath)
+					if err == nil {
+						conn.Close()
+					}
+					return err
+				}, 5).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("with a socket mode", func() {
+			BeforeEach(func() {
+				command.Args = append(command.Args, "-socketMode=0660")
+			})
+
+			It("sets the mode on the socket", func() {
+				Eventually(func() (os.FileMode, error) {
+					info, err := os.Stat(socketPath)
+					if err != nil {
+						return 0, err
+					}
+					return info.Mode().Perm(), nil
+				}, 5).Should(Equal(os.FileMode(0660)))
+			})
+		})
+	})
+
+	Describe("transports", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "driversPath")
+			Expect(err).ToNot(HaveOccurred())
+
+			command.Args = append(command.Args, "-driversPath="+dir, "-logLevel=error")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		itHonorsTheDriverOptions := func(transport string, specName string, expectedSpec func(address string) string) {
+			Context("with -transport="+transport, func() {
+				var network, address string
+
+				BeforeEach(func() {
+					network, address = "tcp", "127.0.0.1:9750"
+					if strings.HasPrefix(transport, "unix") {
+						network, address = "unix", filepath.Join(dir, "localdriver.sock")
+					}
+					command.Args = append(command.Args, "-transport="+transport, "-listenAddr="+address)
+					if strings.HasSuffix(transport, "-json") {
+						command.Args = append(command.Args, "-uniqueVolumeIds")
+					}
+				})
+
+				It("writes the spec and honors the log level", func() {
+					Eventually(func() error {
+						conn, err := net.Dial(network, address)
+						if err == nil {
+							conn.Close()
+						}
+						return err
+					}, 5).ShouldNot(HaveOccurred())
+
+					specFileContents, err := os.ReadFile(filepath.Join(dir, specName))
+					Expect(err).NotTo(HaveOccurred())
+					if strings.HasSuffix(specName, ".json") {
+						Expect(string(specFileContents)).To(MatchJSON(expectedSpec(address)))
+					} else {
+						Expect(string(specFileContents)).To(Equal(expectedSpec(address)))
+					}
+
+					Expect(string(session.Out.Contents())).NotTo(ContainSubstring("writing-spec-file"))
+				})
+			})
+		}
+
+		itHonorsTheDriverOptions("tcp", "localdriver.spec", func(address string) string {
+			return "http://" + address
+		})
+		itHonorsTheDriverOptions("tcp-json", "localdriver.json", func(address string) string {
+			return `{"Name": "localdriver", "Addr": "http://` + address + `", "TLSConfig": null, "UniqueVolumeIds": true}`
+		})
+		itHonorsTheDriverOptions("unix", "localdriver.spec", func(address string) string {
+			return "unix://" + address
+		})
+		itHonorsTheDriverOptions("unix-json", "localdriver.json", func(address string) string {
+			return `{"Name": "localdriver", "Addr": "unix://` + address + `", "TLSConfig": null, "UniqueVolumeIds": true}`
+		})
+
+		Context("with authorization policies but without TLS", func() {
+			BeforeEach(func() {
+				command.Args = append(command.Args, "-transport=tcp-json", "-authorizationPolicies=/some/policies.yml")
+			})
+
+			It("refuses to start", func() {
+				Eventually(session, 5).Should(gexec.Exit())
+				Expect(session.ExitCode()).NotTo(Equal(0))
+				Expect(string(session.Out.Contents())).To(ContainSubstring("-authorizationPolicies requires -requireSSL"))
+			})
+		})
+
+		Context("with a trash retention but without the reaper", func() {
+			BeforeEach(func() {
+				command.Args = append(command.Args, "-transport=tcp-json", "-trashRetention=1h", "-reapInterval=0")
+			})
+
+			It("refuses to start", func() {
+				Eventually(session, 5).Should(gexec.Exit())
+				Expect(session.ExitCode()).NotTo(Equal(0))
+				Expect(string(session.Out.Contents())).To(ContainSubstring("-trashRetention requires the reaper, set -reapInterval"))
+			})
+		})
+
+		Context("with unique volume IDs and a plain spec", func() {
+			BeforeEach(func() {
+				command.Args = append(command.Args, "-transport=tcp", "-uniqueVolumeIds", "-logLevel=info")
+			})
+
+			It("starts without them and says so", func() {
+				Eventually(session.Out, 5).Should(gbytes.Say("ignoring-unique-volume-ids"))
+				Eventually(session.Out, 5).Should(gbytes.Say("started"))
+				Expect(session.ExitCode()).To(Equal(-1))
+
+				specFileContents, err := os.ReadFile(filepath.Join(dir, "localdriver.spec"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(specFileContents)).To(HavePrefix("http://"))
+			})
+		})
+	})
+	Describe("config file", func() {
+		var (
+			dir        string
+			configPath string
+		)
+
+		writeConfig := func(config string) {
+			Expect(os.WriteFile(configPath, []byte(config), 0644)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "driversPath")
+			Expect(err).ToNot(HaveOccurred())
+			configPath = filepath.Join(dir, "localdriver.yml")
+
+			writeConfig(`
+listen_addr: 127.0.0.1:9751
+transport: tcp-json
+drivers_path: ` + dir + `
+unique_volume_ids: true
+idempotency_window: 5m
+pools:
+  - name: fast
+    path: ` + filepath.Join(dir, "fast") + `
+    capacity: 10G
+logging:
+  level: info
+`)
+			command.Args = append(command.Args, "-config="+configPath)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		readSpec := func(address string) string {
+			Eventually(func() error {
+				conn, err := net.Dial("tcp", address)
+				if err == nil {
+					conn.Close()
+				}
+				return err
+			}, 5).ShouldNot(HaveOccurred())
+
+			specFileContents, err := os.ReadFile(filepath.Join(dir, "localdriver.json"))
+			Expect(err).NotTo(HaveOccurred())
+			return string(specFileContents)
+		}
+
+		It("uses the settings from the file", func() {
+			Expect(readSpec("127.0.0.1:9751")).To(MatchJSON(`{
+				"Name": "localdriver",
+				"Addr": "http://127.0.0.1:9751",
+				"TLSConfig": null,
+				"UniqueVolumeIds": true
+			}`))
+		})
+
+		Context("when a flag is also given", func() {
+			BeforeEach(func() {
+				command.Args = append(command.Args, "-listenAddr=127.0.0.1:9752")
+			})
+
+			It("lets the flag override the file", func() {
+				Expect(readSpec("127.0.0.1:9752")).To(MatchJSON(`{
+					"Name": "localdriver",
+					"Addr": "http://127.0.0.1:9752",
+					"TLSConfig": null,
+					"UniqueVolumeIds": true
+				}`))
+			})
+		})
+
+		Context("when the file is JSON", func() {
+			BeforeEach(func() {
+				writeConfig(`{"listen_addr": "127.0.0.1:9753", "transport": "tcp-json", "drivers_path": "` + dir + `", "advertise_addr": ["10.0.0.1:9753", "10.0.0.2:9753"]}`)
+			})
+
+			It("uses the settings from the file", func() {
+				Expect(readSpec("127.0.0.1:9753")).To(MatchJSON(`{
+					"Name": "localdriver",
+					"Addr": "http://10.0.0.1:9753",
+					"Addrs": ["http://10.0.0.1:9753", "http://10.0.0.2:9753"],
+					"TLSConfig": null,
+					"UniqueVolumeIds": false
+				}`))
+			})
+		})
+
+		Context("when the file is the documented example", func() {
+			BeforeEach(func() {
+				docs, err := os.ReadFile(filepath.Join("..", "..", "docs", "040-config-file.md"))
+				Expect(err).NotTo(HaveOccurred())
+				_, example, found := strings.Cut(string(docs), "```yaml\n")
+				Expect(found).To(BeTrue())
+				example, _, found = strings.Cut(example, "```")
+				Expect(found).To(BeTrue())
+				writeConfig(example)
+
+				// the paths and addresses of the example do not exist here
+				command.Args = append(command.Args,
+					"-listenAddr=127.0.0.1:9754",
+					"-driversPath="+dir,
+					"-mountDir="+filepath.Join(dir, "volumes"),
+					"-pools=",
+					"-adminAddr=127.0.0.1:9755",
+					"-debugAddr=",
+					"-requireSSL=false",
+					"-authorizationPolicies=",
+				)
+			})
+
+			It("starts with the rate limits from the file", func() {
+				limits := func() (string, error) {
+					response, err := http.Get("http://127.0.0.1:9755/limits")
+					if err != nil {
+						return "", err
+					}
+					defer response.Body.Close()
+					body, err := io.ReadAll(response.Body)
+					return string(body), err
+				}
+
+				Eventually(limits, 5).Should(MatchJSON(`{"global_rate": 200, "global_burst": 400, "client_rate": 20, "client_burst": 40, "max_concurrent_operations": 8}`))
+			})
+		})
+
+		DescribeTable("rejects invalid settings naming the field",
+			func(badConfig string, message string) {
+				session.Kill().Wait("2s")
+				writeConfig(badConfig)
+
+				session, err = gexec.Start(exec.Command(driverPath, command.Args[1:]...), GinkgoWriter, GinkgoWriter)
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(session, 5).Should(gexec.Exit(2))
+				Expect(string(session.Err.Contents())).To(ContainSubstring(message))
+			},
+			Entry("an unknown setting", "tls:\n  cert_flie: cert.pem\n", "tls.cert_flie (line 2): unknown setting"),
+			Entry("a bad duration", "reap_interval: soon\n", "reap_interval (line 1): invalid value 'soon'"),
+			Entry("a bad idempotency window", "idempotency_window: soon\n", "idempotency_window (line 1): invalid value 'soon'"),
+			Entry("a bad boolean", "tls:\n  require: maybe\n", "tls.require (line 2): invalid value 'maybe'"),
+			Entry("a bad transport", "transport: carrier-pigeon\n", "transport (line 1): invalid transport 'carrier-pigeon'"),
+			Entry("a bad pool capacity", "pools:\n  - name: fast\n    path: /fast\n    capacity: lots\n", "pools[0].capacity (line 2)"),
+			Entry("a bad minimum free space", "min_free_space: plenty\n", "min_free_space (line 1)"),
+			Entry("a bad memory volume size", "max_memory_volume_size: huge\n", "max_memory_volume_size (line 1)"),
+			Entry("a pool without a path", "pools:\n  - name: fast\n", "pools[0].path (line 2): is required"),
+			Entry("a list where a value belongs", "mount_dir: [a, b]\n", "mount_dir (line 1): expected a single value"),
+		)
+	})
+	Describe("reloading on SIGHUP", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "driversPath")
+			Expect(err).ToNot(HaveOccurred())
+
+			command.Args = append(command.Args, "-driversPath="+dir, "-transport=tcp-json")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		Context("with TLS", func() {
+			var (
+				authority *certtest.Authority
+				tlsConfig *tls.Config
+				certFile  string
+				keyFile   string
+			)
+
+			writeServerCertificate := func(name string) {
+				cert, err := authority.BuildSignedCertificate(name)
+				Expect(err).NotTo(HaveOccurred())
+				certPEM, keyPEM, err := cert.CertificatePEMAndPrivateKey()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.WriteFile(certFile, certPEM, 0600)).To(Succeed())
+				Expect(os.WriteFile(keyFile, keyPEM, 0600)).To(Succeed())
+			}
+
+			servedCertificate := func() (string, error) {
+				conn, err := tls.Dial("tcp", "127.0.0.1:9760", tlsConfig)
+				if err != nil {
+					return "", err
+				}
+				defer conn.Close()
+				return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+			}
+
+			BeforeEach(func() {
+				var err error
+				authority, err = certtest.BuildCA("localdriver-ca")
+				Expect(err).NotTo(HaveOccurred())
+
+				caPEM, err := authority.CertificatePEM()
+				Expect(err).NotTo(HaveOccurred())
+				caFile := filepath.Join(dir, "ca.crt")
+				Expect(os.WriteFile(caFile, caPEM, 0600)).To(Succeed())
+
+				certFile = filepath.Join(dir, "server.crt")
+				keyFile = filepath.Join(dir, "server.key")
+				writeServerCertificate("server-1")
+
+				clientCert, err := authority.BuildSignedCertificate("client")
+				Expect(err).NotTo(HaveOccurred())
+				clientCertPEM, clientKeyPEM, err := clientCert.CertificatePEMAndPrivateKey()
+				Expect(err).NotTo(HaveOccurred())
+				clientCertFile := filepath.Join(dir, "client.crt")
+				clientKeyFile := filepath.Join(dir, "client.key")
+				Expect(os.WriteFile(clientCertFile, clientCertPEM, 0600)).To(Succeed())
+				Expect(os.WriteFile(clientKeyFile, clientKeyPEM, 0600)).To(Succeed())
+
+				tlsCert, err := clientCert.TLSCertificate()
+				Expect(err).NotTo(HaveOccurred())
+				pool, err := authority.CertPool()
+				Expect(err).NotTo(HaveOccurred())
+				tlsConfig = &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{tlsCert}}
+
+				command.Args = append(command.Args,
+					"-listenAddr=127.0.0.1:9760",
+					"-requireSSL",
+					"-certFile="+certFile,
+					"-keyFile="+keyFile,
+					"-caFile="+caFile,
+					"-clientCertFile="+clientCertFile,
+					"-clientKeyFile="+clientKeyFile,
+				)
+			})
+
+			It("serves the new certificate without restarting", func() {
+				Eventually(servedCertificate, 5).Should(Equal("server-1"))
+
+				writeServerCertificate("server-2")
+				session.Signal(syscall.SIGHUP)
+
+				Eventually(servedCertificate, 5).Should(Equal("server-2"))
+				Expect(session.ExitCode()).To(Equal(-1))
+			})
+
+			Context("when the new certificate cannot be read", func() {
+				It("keeps serving the old certificate", func() {
+					Eventually(servedCertificate, 5).Should(Equal("server-1"))
+
+					Expect(os.WriteFile(keyFile, []byte("garbage"), 0600)).To(Succeed())
+					session.Signal(syscall.SIGHUP)
+
+					Eventually(session.Out, 5).Should(gbytes.Say("failed-reloading-tls"))
+					Expect(servedCertificate()).To(Equal("server-1"))
+				})
+			})
+		})
+
+		Context("with a config file", func() {
+			var configPath string
+
+			BeforeEach(func() {
+				configPath = filepath.Join(dir, "localdriver.yml")
+				Expect(os.WriteFile(configPath, []byte("listen_addr: 127.0.0.1:9761\nlogging:\n  level: error\n"), 0644)).To(Succeed())
+				command.Args = append(command.Args, "-config="+configPath)
+			})
+
+			It("applies the new log level and reports settings that need a restart", func() {
+				Eventually(func() error {
+					conn, err := net.Dial("tcp", "127.0.0.1:9761")
+					if err == nil {
+						conn.Close()
+					}
+					return err
+				}, 5).ShouldNot(HaveOccurred())
+
+				Expect(os.WriteFile(configPath, []byte("listen_addr: 127.0.0.1:9762\nlogging:\n  level: debug\n"), 0644)).To(Succeed())
+				session.Signal(syscall.SIGHUP)
+
+				Eventually(session.Out, 5).Should(gbytes.Say(`failed-changing-setting.*listen_addr`))
+				Eventually(session.Out, 5).Should(gbytes.Say(`setting-changed.*"from":"error".*"setting":"logging.level".*"to":"debug"`))
+				Expect(session.ExitCode()).To(Equal(-1))
+			})
+		})
+
+		Context("with rate limits in the config file", func() {
+			var configPath string
+
+			limits := func() (string, error) {
+				response, err := http.Get("http://127.0.0.1:9764/limits")
+				if err != nil {
+					return "", err
+				}
+				defer response.Body.Close()
+				body, err := io.ReadAll(response.Body)
+				return string(body), err
+			}
+
+			BeforeEach(func() {
+				configPath = filepath.Join(dir, "localdriver.yml")
+				Expect(os.WriteFile(configPath, []byte("listen_addr: 127.0.0.1:9763\nadmin_addr: 127.0.0.1:9764\nrate_limit:\n  client: 5\n"), 0644)).To(Succeed())
+				command.Args = append(command.Args, "-config="+configPath)
+			})
+
+			It("applies the new limits", func() {
+				Eventually(limits, 5).Should(MatchJSON(`{"global_rate": 0, "global_burst": 0, "client_rate": 5, "client_burst": 0, "max_concurrent_operations": 0}`))
+
+				Expect(os.WriteFile(configPath, []byte("listen_addr: 127.0.0.1:9763\nadmin_addr: 127.0.0.1:9764\nrate_limit:\n  client: 7\n  max_concurrent_operations: 3\n"), 0644)).To(Succeed())
+				session.Signal(syscall.SIGHUP)
+
+				Eventually(session.Out, 5).Should(gbytes.Say(`setting-changed.*"setting":"rate_limit.client"`))
+				Eventually(limits, 5).Should(MatchJSON(`{"global_rate": 0, "global_burst": 0, "client_rate": 7, "client_burst": 0, "max_concurrent_operations": 3}`))
+				Expect(session.ExitCode()).To(Equal(-1))
+			})
+		})
+	})
+	Describe("admin API", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "driversPath")
+			Expect(err).ToNot(HaveOccurred())
+
+			command.Args = append(command.Args, "-driversPath="+dir, "-transport=tcp-json", "-listenAddr=127.0.0.1:9780")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		Context("on an address other than loopback without TLS", func() {
+			BeforeEach(func() {
+				command.Args = append(command.Args, "-adminAddr=0.0.0.0:9781")
+			})
+
+			It("refuses to start", func() {
+				Eventually(session, 5).Should(gexec.Exit())
+				Expect(session.ExitCode()).NotTo(Equal(0))
+				Expect(string(session.Out.Contents())).To(ContainSubstring("-adminAddr 0.0.0.0:9781 is not a loopback address, serving the admin API there requires -requireSSL"))
+			})
+		})
+
+		Context("with TLS and authorization policies", func() {
+			var authority *certtest.Authority
+
+			writeCertificate := func(name string) (string, string) {
+				cert, err := authority.BuildSignedCertificate(name)
+				Expect(err).NotTo(HaveOccurred())
+				certPEM, keyPEM, err := cert.CertificatePEMAndPrivateKey()
+				Expect(err).NotTo(HaveOccurred())
+				certFile := filepath.Join(dir, name+".crt")
+				keyFile := filepath.Join(dir, name+".key")
+				Expect(os.WriteFile(certFile, certPEM, 0600)).To(Succeed())
+				Expect(os.WriteFile(keyFile, keyPEM, 0600)).To(Succeed())
+				return certFile, keyFile
+			}
+
+			adminClient := func(name string) *http.Client {
+				pool, err := authority.CertPool()
+				Expect(err).NotTo(HaveOccurred())
+				tlsConfig := &tls.Config{RootCAs: pool}
+				if name != "" {
+					cert, err := authority.BuildSignedCertificate(name)
+					Expect(err).NotTo(HaveOccurred())
+					tlsCert, err := cert.TLSCertificate()
+					Expect(err).NotTo(HaveOccurred())
+					tlsConfig.Certificates = []tls.Certificate{tlsCert}
+				}
+				return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+			}
+
+			BeforeEach(func() {
+				var err error
+				authority, err = certtest.BuildCA("localdriver-ca")
+				Expect(err).NotTo(HaveOccurred())
+				caPEM, err := authority.CertificatePEM()
+				Expect(err).NotTo(HaveOccurred())
+				caFile := filepath.Join(dir, "ca.crt")
+				Expect(os.WriteFile(caFile, caPEM, 0600)).To(Succeed())
+
+				certFile, keyFile := writeCertificate("server")
+				clientCertFile, clientKeyFile := writeCertificate("client")
+				policiesFile := filepath.Join(dir, "policies.yml")
+				Expect(os.WriteFile(policiesFile, []byte("policies:\n- subjects: [CN=operator]\n  operations: [admin]\n- subjects: [CN=cell]\n  operations: ['*']\n"), 0644)).To(Succeed())
+
+				command.Args = append(command.Args,
+					"-adminAddr=0.0.0.0:9781",
+					"-requireSSL",
+					"-certFile="+certFile,
+					"-keyFile="+keyFile,
+					"-caFile="+caFile,
+					"-clientCertFile="+clientCertFile,
+					"-clientKeyFile="+clientKeyFile,
+					"-authorizationPolicies="+policiesFile,
+				)
+			})
+
+			It("serves only clients the policies grant the admin operation", func() {
+				status := func(client *http.Client) func() (int, error) {
+					return func() (int, error) {
+						response, err := client.Get("https://127.0.0.1:9781/limits")
+						if err != nil {
+							return 0, err
+						}
+						response.Body.Close()
+						return response.StatusCode, nil
+					}
+				}
+
+				Eventually(status(adminClient("operator")), 5).Should(Equal(http.StatusOK))
+				Expect(status(adminClient("cell"))()).To(Equal(http.StatusForbidden))
+				_, err := status(adminClient(""))()
+				Expect(err).To(HaveOccurred())
+				Expect(session.Out).To(gbytes.Say(`audit.denied.*"operation":"admin"`))
+			})
+		})
+	})
+
+	Describe("rate limits", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "driversPath")
+			Expect(err).ToNot(HaveOccurred())
+
+			command.Args = append(command.Args,
+				"-driversPath="+dir,
+				"-listenAddr=127.0.0.1:9770",
+				"-clientRateLimit=0.01",
+				"-clientRateBurst=1",
+			)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("rejects clients over their rate", func() {
+			list := func() (int, error) {
+				response, err := http.Post("http://127.0.0.1:9770/VolumeDriver.List", "application/json", strings.NewReader("{}"))
+				if err != nil {
+					return 0, err
+				}
+				defer response.Body.Close()
+				return response.StatusCode, nil
+			}
+
+			Eventually(list, 5).Should(Equal(http.StatusOK))
+			Expect(list()).To(Equal(http.StatusTooManyRequests))
+		})
+	})
+	Describe("retried mounts", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "driversPath")
+			Expect(err).ToNot(HaveOccurred())
+
+			command.Args = append(command.Args,
+				"-driversPath="+dir,
+				"-mountDir="+filepath.Join(dir, "volumes"),
+				"-listenAddr=127.0.0.1:9771",
+			)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		call := func(route, body string) map[string]interface{} {
+			response, err := http.Post("http://127.0.0.1:9771/VolumeDriver."+route, "application/json", strings.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			defer response.Body.Close()
+
+			var decoded map[string]interface{}
+			Expect(json.NewDecoder(response.Body).Decode(&decoded)).To(Succeed())
+			return decoded
+		}
+
+		It("counts a mount retried by the same container once", func() {
+			Eventually(func() error {
+				conn, err := net.Dial("tcp", "127.0.0.1:9771")
+				if err == nil {
+					conn.Close()
+				}
+				return err
+			}, 5).ShouldNot(HaveOccurred())
+
+			Expect(call("Create", `{"Name": "some-volume"}`)).To(HaveKeyWithValue("Err", ""))
+			Expect(call("Mount", `{"Name": "some-volume", "ID": "container-1"}`)).To(HaveKeyWithValue("Err", ""))
+			Expect(call("Mount", `{"Name": "some-volume", "ID": "container-1"}`)).To(HaveKeyWithValue("Err", ""))
+			Expect(call("Unmount", `{"Name": "some-volume", "ID": "container-1"}`)).To(HaveKeyWithValue("Err", ""))
+
+			volume := call("Get", `{"Name": "some-volume"}`)["Volume"].(map[string]interface{})
+			Expect(volume["Mountpoint"]).To(BeEmpty())
+		})
+
+		It("renews a mount lease through the driver endpoint", func() {
+			Eventually(func() error {
+				conn, err := net.Dial("tcp", "127.0.0.1:9771")
+				if err == nil {
+					conn.Close()
+				}
+				return err
+			}, 5).ShouldNot(HaveOccurred())
+
+			Expect(call("Create", `{"Name": "some-volume"}`)).To(HaveKeyWithValue("Err", ""))
+			Expect(call("Mount", `{"Name": "some-volume", "ID": "container-1", "Opts": {"lease": "1m"}}`)).To(HaveKeyWithValue("Err", ""))
+			Expect(call("Heartbeat", `{"Name": "some-volume", "ID": "container-1"}`)).To(HaveKeyWithValue("Err", ""))
+			Expect(call("Heartbeat", `{"Name": "some-volume", "ID": "container-2"}`)).To(HaveKeyWithValue("Err", "Volume 'some-volume' is not mounted by 'container-2'"))
+		})
+	})
 })
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/localdriver/ratelimit"
+	"code.cloudfoundry.org/localdriver/reaper"
+)
+
+// tlsReloader hands out the most recently built server TLS config to each new
+// connection, so certificates can be rotated without closing the listener.
+type tlsReloader struct {
+	build   func() (*tls.Config, error)
+	current atomic.Pointer[tls.Config]
+}
+
+func newTLSReloader(build func() (*tls.Config, error)) (*tlsReloader, error) {
+	reloader := &tlsReloader{build: build}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (t *tlsReloader) reload() error {
+	config, err := t.build()
+	if err != nil {
+		return err
+	}
+	t.current.Store(config)
+	return nil
+}
+
+func (t *tlsReloader) serverConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return t.current.Load(), nil
+		},
+	}
+}
+
+// reloader re-reads the TLS material and the reloadable settings of the
+// config file whenever the driver receives SIGHUP. Settings given on the
+// command line are left alone, and settings that can only take effect on
+// restart are logged and ignored.
+type reloader struct {
+	logger  lager.Logger
+	sink    *lager.ReconfigurableSink
+	tls     *tlsReloader
+	reaper  *reaper.Reaper
+	limiter *ratelimit.Limiter
+	flagSet *flag.FlagSet
+}
+
+func newReloader(logger lager.Logger, sink *lager.ReconfigurableSink, tls *tlsReloader, reaper *reaper.Reaper, limiter *ratelimit.Limiter) *reloader {
+	return &reloader{
+		logger:  logger.Session("reloader"),
+		sink:    sink,
+		tls:     tls,
+		reaper:  reaper,
+		limiter: limiter,
+		flagSet: flag.CommandLine,
+	}
+}
+
+func (r *reloader) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	close(ready)
+
+	for {
+		select {
+		case <-hangups:
+			r.reload()
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+func (r *reloader) reload() {
+	logger := r.logger.Session("reload")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if r.tls != nil {
+		if err := r.tls.reload(); err != nil {
+			logger.Error("failed-reloading-tls", err, lager.Data{"cert_file": *certFile, "key_file": *keyFile, "ca_file": *caFile})
+		} else {
+			logger.Info("reloaded-tls", lager.Data{"cert_file": *certFile, "key_file": *keyFile, "ca_file": *caFile})
+		}
+	}
+
+	if *configFile == "" {
+		return
+	}
+
+	settings, err := loadConfigFile(*configFile)
+	if err != nil {
+		logger.Error("failed-reading-config", err, lager.Data{"path": *configFile})
+		return
+	}
+
+	for _, setting := range settings {
+		if commandLineFlags[setting.flag] {
+			continue
+		}
+
+		f := r.flagSet.Lookup(setting.flag)
+		if !settingChanged(f, setting.value) {
+			continue
+		}
+		from := f.Value.String()
+
+		if err := r.apply(setting); err != nil {
+			logger.Error("failed-changing-setting", err, lager.Data{"setting": setting.field, "value": setting.value})
+			continue
+		}
+		logger.Info("setting-changed", lager.Data{"setting": setting.field, "from": from, "to": f.Value.String()})
+	}
+}
+
+func (r *reloader) apply(setting configSetting) error {
+	switch setting.flag {
+	case "logLevel":
+		level, err := lager.LogLevelFromString(setting.value)
+		if err != nil {
+			return err
+		}
+		r.sink.SetMinLevel(level)
+	case "reapInterval":
+		interval, err := time.ParseDuration(setting.value)
+		if err != nil {
+			return err
+		}
+		if r.reaper == nil || interval <= 0 {
+			return fmt.Errorf("starting or stopping the reaper requires a restart")
+		}
+		r.reaper.SetInterval(interval)
+	case "globalRateLimit", "globalRateBurst", "clientRateLimit", "clientRateBurst", "maxConcurrentOperations":
+		previous := r.flagSet.Lookup(setting.flag).Value.String()
+		if err := r.flagSet.Set(setting.flag, setting.value); err != nil {
+			return err
+		}
+		if err := r.limiter.SetLimits(rateLimitsFromFlags()); err != nil {
+			r.flagSet.Set(setting.flag, previous)
+			return err
+		}
+	default:
+		return fmt.Errorf("changing %s requires a restart", setting.field)
+	}
+
+	return r.flagSet.Set(setting.flag, setting.value)
+}
+
+// settingChanged compares a config value with the current flag value,
+// parsing typed values so that e.g. 60s and 1m0s are equal.
+func settingChanged(f *flag.Flag, value string) bool {
+	if getter, ok := f.Value.(flag.Getter); ok {
+		switch current := getter.Get().(type) {
+		case time.Duration:
+			parsed, err := time.ParseDuration(value)
+			return err != nil || parsed != current
+		case bool:
+			parsed, err := strconv.ParseBool(value)
+			return err != nil || parsed != current
+		case float64:
+			parsed, err := strconv.ParseFloat(value, 64)
+			return err != nil || parsed != current
+		case int:
+			parsed, err := strconv.Atoi(value)
+			return err != nil || parsed != current
+		}
+	}
+	return f.Value.String() != value
+}
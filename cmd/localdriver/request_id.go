@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"code.cloudfoundry.org/localdriver"
+)
+
+// requestIDRoutes are the volume plugin calls docker sends the ID of the
+// calling container with.
+var requestIDRoutes = map[string]bool{
+	"/VolumeDriver.Mount":   true,
+	"/VolumeDriver.Unmount": true,
+}
+
+// withRequestIDs passes the ID field of the request body on to the driver
+// through the request context, since the driver request types do not carry
+// it.
+func withRequestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !requestIDRoutes[req.URL.Path] || req.Body == nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		var request struct {
+			ID string
+		}
+		if json.Unmarshal(body, &request) == nil && request.ID != "" {
+			req = req.WithContext(localdriver.WithRequestID(req.Context(), request.ID))
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// gracefulShutdown is the last member of the process group, so it is the
+// first to be signalled. It withdraws the driver spec so that volman stops
+// dialing us, rejects new requests and waits, up to a deadline, for the
+// requests already in flight before letting the servers stop.
+type gracefulShutdown struct {
+	logger  lager.Logger
+	timeout time.Duration
+
+	lock     sync.RWMutex
+	draining bool
+	inFlight sync.WaitGroup
+	paths    []string
+}
+
+func newGracefulShutdown(logger lager.Logger, timeout time.Duration) *gracefulShutdown {
+	return &gracefulShutdown{
+		logger:  logger.Session("graceful-shutdown"),
+		timeout: timeout,
+	}
+}
+
+// removeOnShutdown registers a file, such as the driver spec, to be deleted
+// when shutdown starts.
+func (g *gracefulShutdown) removeOnShutdown(path string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.paths = append(g.paths, path)
+}
+
+// wrap tracks the requests served by handler and turns new requests away
+// once shutdown has started.
+func (g *gracefulShutdown) wrap(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		g.lock.RLock()
+		if g.draining {
+			g.lock.RUnlock()
+			jsonBytes, _ := json.Marshal(dockerdriver.ErrorResponse{Err: "localdriver is shutting down"})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write(jsonBytes)
+			return
+		}
+		g.inFlight.Add(1)
+		g.lock.RUnlock()
+
+		defer g.inFlight.Done()
+		handler.ServeHTTP(w, req)
+	})
+}
+
+func (g *gracefulShutdown) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	close(ready)
+
+	signal := <-signals
+	g.logger.Info("start", lager.Data{"signal": signal.String(), "timeout": g.timeout.String()})
+	defer g.logger.Info("end")
+
+	g.lock.Lock()
+	g.draining = true
+	paths := g.paths
+	g.lock.Unlock()
+
+	for _, path := range paths {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			g.logger.Error("failed-removing-file", err, lager.Data{"path": path})
+			continue
+		}
+		g.logger.Info("removed-file", lager.Data{"path": path})
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		g.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		g.logger.Info("drained")
+	case <-time.After(g.timeout):
+		g.logger.Info("timed-out-waiting-for-requests")
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/tedsuo/ifrit"
+)
+
+// removeStaleSocket deletes a socket left behind by a previous run, so that
+// listening on socketPath does not fail. Anything other than a socket is left
+// alone.
+func removeStaleSocket(logger lager.Logger, socketPath string) error {
+	info, err := os.Lstat(socketPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", socketPath)
+	}
+
+	logger.Info("removing-stale-socket", lager.Data{"path": socketPath})
+	return os.Remove(socketPath)
+}
+
+// socketPermissions parses the -socketMode and -socketGroup flags. A zero
+// mode and a gid of -1 mean the respective setting is left unchanged.
+func socketPermissions(mode, group string) (os.FileMode, int, error) {
+	var fileMode os.FileMode
+	if mode != "" {
+		parsed, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || parsed > 0777 {
+			return 0, 0, fmt.Errorf("invalid socket mode '%s'", mode)
+		}
+		fileMode = os.FileMode(parsed)
+	}
+
+	gid := -1
+	if group != "" {
+		if id, err := strconv.Atoi(group); err == nil {
+			gid = id
+		} else {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid socket group '%s': %s", group, err)
+			}
+			gid, err = strconv.Atoi(g.Gid)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid socket group '%s': %s", group, err)
+			}
+		}
+	}
+
+	return fileMode, gid, nil
+}
+
+type socketPermissionsRunner struct {
+	logger     lager.Logger
+	runner     ifrit.Runner
+	socketPath string
+	mode       os.FileMode
+	gid        int
+}
+
+// newSocketPermissionsRunner wraps a unix socket server so that the socket's
+// mode and group are set once it is listening, before it reports ready.
+func newSocketPermissionsRunner(logger lager.Logger, runner ifrit.Runner, socketPath string, mode os.FileMode, gid int) ifrit.Runner {
+	if mode == 0 && gid == -1 {
+		return runner
+	}
+
+	return &socketPermissionsRunner{
+		logger:     logger.Session("socket-permissions"),
+		runner:     runner,
+		socketPath: socketPath,
+		mode:       mode,
+		gid:        gid,
+	}
+}
+
+func (r *socketPermissionsRunner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	process := ifrit.Background(r.runner)
+
+	select {
+	case <-process.Ready():
+	case err := <-process.Wait():
+		return err
+	}
+
+	if err := r.apply(); err != nil {
+		r.logger.Error("failed-setting-socket-permissions", err, lager.Data{"path": r.socketPath})
+		process.Signal(os.Interrupt)
+		<-process.Wait()
+		return err
+	}
+
+	close(ready)
+
+	select {
+	case signal := <-signals:
+		process.Signal(signal)
+		return <-process.Wait()
+	case err := <-process.Wait():
+		return err
+	}
+}
+
+func (r *socketPermissionsRunner) apply() error {
+	if r.gid != -1 {
+		if err := os.Chown(r.socketPath, -1, r.gid); err != nil {
+			return err
+		}
+	}
+	if r.mode != 0 {
+		if err := os.Chmod(r.socketPath, r.mode); err != nil {
+			return err
+		}
+	}
+	r.logger.Info("socket-permissions-set", lager.Data{"path": r.socketPath, "mode": fmt.Sprintf("%#o", r.mode), "gid": r.gid})
+	return nil
+}
@@ -0,0 +1,222 @@
+package localdriver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+)
+
+// copyBlockSize is the unit in which files are copied. Blocks holding only
+// zeros are skipped, leaving a hole in the copy.
+const copyBlockSize = 64 * 1024
+
+// copyTree copies the directory tree at src to dst, preserving the owner and
+// mode of every entry, symlinks, and the holes of sparse files. dst must not
+// exist yet. With bestEffortOwners, entries the driver is not permitted to
+// give their original owner are left owned by the driver instead of failing
+// the copy.
+func (d *LocalDriver) copyTree(src, dst string, bestEffortOwners bool) error {
+	type copiedDir struct {
+		path string
+		info os.FileInfo
+	}
+	var dirs []copiedDir
+
+	err := d.filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := d.filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := d.filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			// the mode is applied once the directory is filled, it may not
+			// allow adding entries
+			if err := d.os.Mkdir(target, 0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, copiedDir{path: target, info: info})
+			return nil
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := d.os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := d.os.Symlink(link, target); err != nil {
+				return err
+			}
+			if uid, gid, ok := fileOwner(info); ok {
+				return ownerError(d.os.Lchown(target, uid, gid), bestEffortOwners)
+			}
+			return nil
+		case info.Mode().IsRegular():
+			if err := d.copyFile(path, target); err != nil {
+				return err
+			}
+			return d.copyOwnerAndMode(target, info, bestEffortOwners)
+		default:
+			return fmt.Errorf("cannot copy special file %s", path)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := d.copyOwnerAndMode(dirs[i].path, dirs[i].info, bestEffortOwners); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyOwnerAndMode gives path the owner and mode described by info. The
+// owner goes first, since changing it clears the setuid and setgid bits. A
+// copy left owned by the driver does not get those bits, which would grant
+// the driver's user instead of the original owner.
+func (d *LocalDriver) copyOwnerAndMode(path string, info os.FileInfo, bestEffortOwners bool) error {
+	mode := info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	if uid, gid, ok := fileOwner(info); ok {
+		if err := d.os.Chown(path, uid, gid); err != nil {
+			if ownerError(err, bestEffortOwners) != nil {
+				return err
+			}
+			mode &^= os.ModeSetuid | os.ModeSetgid
+		}
+	}
+	return d.os.Chmod(path, mode)
+}
+
+// ownerError drops the permission error of a change of owner the driver is
+// not privileged to make, when owners are copied on a best effort basis.
+func ownerError(err error, bestEffortOwners bool) error {
+	if bestEffortOwners && os.IsPermission(err) {
+		return nil
+	}
+	return err
+}
+
+func (d *LocalDriver) copyFile(src, dst string) error {
+	in, err := d.os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := d.os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := copySparse(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copySparse copies in to out, seeking over blocks of zeros instead of
+// writing them.
+func copySparse(out *os.File, in io.Reader) error {
+	block := make([]byte, copyBlockSize)
+	zeros := make([]byte, copyBlockSize)
+	var size int64
+	for {
+		n, err := io.ReadFull(in, block)
+		if n > 0 {
+			if bytes.Equal(block[:n], zeros[:n]) {
+				_, err = out.Seek(int64(n), io.SeekCurrent)
+			} else {
+				_, err = out.Write(block[:n])
+			}
+			if err != nil {
+				return err
+			}
+			size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// seeking does not extend a file that ends with a hole
+	return out.Truncate(size)
+}
+
+// verifyTree checks that dst holds the same entries as src, with the same
+// owners, modes, link targets and file contents.
+func (d *LocalDriver) verifyTree(src, dst string) error {
+	srcEntries, err := d.treeDigest(src)
+	if err != nil {
+		return err
+	}
+	dstEntries, err := d.treeDigest(dst)
+	if err != nil {
+		return err
+	}
+
+	if len(srcEntries) != len(dstEntries) {
+		return fmt.Errorf("copy has %d entries, expected %d", len(dstEntries), len(srcEntries))
+	}
+	for path, digest := range srcEntries {
+		if !bytes.Equal(dstEntries[path], digest) {
+			return fmt.Errorf("copy of %s does not match the original", path)
+		}
+	}
+	return nil
+}
+
+func (d *LocalDriver) treeDigest(root string) (map[string][]byte, error) {
+	entries := map[string][]byte{}
+	err := d.filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := d.filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		hash := sha256.New()
+		fmt.Fprintf(hash, "%s\x00", info.Mode())
+		if uid, gid, ok := fileOwner(info); ok {
+			fmt.Fprintf(hash, "%d:%d\x00", uid, gid)
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := d.os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			io.WriteString(hash, link)
+		case info.Mode().IsRegular():
+			f, err := d.os.Open(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(hash, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		entries[rel] = hash.Sum(nil)
+		return nil
+	})
+	return entries, err
+}
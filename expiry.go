@@ -0,0 +1,110 @@
+package localdriver
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+type ReapResponse struct {
+	// Removed lists the expired volumes that were removed.
+	Removed []string
+	// Mounted lists the expired volumes that were kept because they are
+	// still mounted.
+	Mounted []string
+	// Purged lists the trashed volumes whose retention period ended.
+	Purged []string
+	// Released lists the mounts whose lease ran out.
+	Released []ReleasedLease
+	Err      string
+}
+
+// ttlFromOpts reads the "ttl" create option, either a duration string such
+// as "90m" or a number of seconds.
+func ttlFromOpts(opts map[string]interface{}) (time.Duration, error) {
+	return durationFromOpts(opts, "ttl")
+}
+
+// durationFromOpts reads a positive duration option, given either as a
+// duration string or a number of seconds. A missing option is zero.
+func durationFromOpts(opts map[string]interface{}, name string) (time.Duration, error) {
+	raw, ok := opts[name]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+
+	var duration time.Duration
+	switch value := raw.(type) {
+	case string:
+		var err error
+		duration, err = time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid '%s' option: %s", name, err)
+		}
+	case float64:
+		duration = time.Duration(value * float64(time.Second))
+	case int:
+		duration = time.Duration(value) * time.Second
+	default:
+		return 0, fmt.Errorf("Invalid '%s' option: %v", name, raw)
+	}
+
+	if duration <= 0 {
+		return 0, fmt.Errorf("Invalid '%s' option: must be positive", name)
+	}
+	return duration, nil
+}
+
+func (v *LocalVolumeInfo) expired(now time.Time) bool {
+	return !v.ExpiresAt.IsZero() && !now.Before(v.ExpiresAt)
+}
+
+// ReapExpired releases mounts whose lease has run out, removes the volumes
+// whose ttl has passed and that are not mounted, purges trashed volumes that
+// are past their retention, and cleans up images left by failed creates.
+func (d *LocalDriver) ReapExpired(env dockerdriver.Env) ReapResponse {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	logger := env.Logger().Session("reap-expired")
+	now := d.clock.Now()
+
+	response := ReapResponse{}
+	var errs []string
+	response.Released, errs = d.releaseExpiredLeases(logger, now)
+	for _, vol := range d.volumes {
+		if !vol.expired(now) {
+			continue
+		}
+
+		if vol.MountCount > 0 {
+			logger.Info("expired-volume-still-mounted", lager.Data{"volume": vol.Name, "expires_at": vol.ExpiresAt, "count": vol.MountCount})
+			response.Mounted = append(response.Mounted, vol.Name)
+			continue
+		}
+
+		logger.Info("removing-expired-volume", lager.Data{"volume": vol.Name, "expires_at": vol.ExpiresAt})
+		if removeResponse := d.removeVolume(logger, vol); removeResponse.Err != "" {
+			errs = append(errs, removeResponse.Err)
+			continue
+		}
+		response.Removed = append(response.Removed, vol.Name)
+	}
+
+	purged, purgeErrs := d.purgeTrash(logger, now)
+	response.Purged = purged
+	errs = append(errs, purgeErrs...)
+	errs = append(errs, d.cleanupStrayImages(logger)...)
+
+	sort.Strings(response.Removed)
+	sort.Strings(response.Mounted)
+	sort.Strings(response.Purged)
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		response.Err = fmt.Sprintf("Failed removing expired volumes: %v", errs)
+	}
+	return response
+}
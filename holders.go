@@ -0,0 +1,82 @@
+package localdriver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SharedMountName is the mountpoint, next to those of the holders, that
+// callers without an ID share.
+const SharedMountName = "_shared"
+
+// MountHolder records a caller that identified itself with the ID docker
+// sends along with Mount and Unmount, usually the container ID.
+type MountHolder struct {
+	MountedAt time.Time
+	// Lease is how long the holder may go without a heartbeat before its
+	// mount is released. Zero means the mount is held until it is unmounted.
+	Lease          time.Duration
+	LeaseExpiresAt time.Time
+	// Subpath is the directory inside the volume the holder mounted, empty
+	// for the whole volume.
+	Subpath string
+	// Layer is the kind of copy-on-write layer the holder mounted, empty
+	// when it writes to the volume itself.
+	Layer string
+}
+
+// holds reports whether holder has the volume mounted. Callers without an
+// ID are never tracked by name.
+func (vol *LocalVolumeInfo) holds(holder string) bool {
+	_, ok := vol.Holders[holder]
+	return holder != "" && ok
+}
+
+// anonymousMounts is the part of the mount count held by callers that did
+// not send an ID.
+func (vol *LocalVolumeInfo) anonymousMounts() int {
+	return vol.MountCount - len(vol.Holders)
+}
+
+func (vol *LocalVolumeInfo) addHolder(id string, holder MountHolder) {
+	if id == "" {
+		return
+	}
+	if vol.Holders == nil {
+		vol.Holders = map[string]MountHolder{}
+	}
+	if holder.Lease > 0 {
+		holder.LeaseExpiresAt = holder.MountedAt.Add(holder.Lease)
+	}
+	vol.Holders[id] = holder
+}
+
+// holderIDs returns the IDs of the named holders in a stable order.
+func (vol *LocalVolumeInfo) holderIDs() []string {
+	ids := make([]string, 0, len(vol.Holders))
+	for id := range vol.Holders {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// remainingHolder picks the mount that stands for the volume once the one it
+// was reported under is released: the shared mount if there is one, else the
+// first holder.
+func (vol *LocalVolumeInfo) remainingHolder() string {
+	if vol.anonymousMounts() > 0 || len(vol.Holders) == 0 {
+		return ""
+	}
+	return vol.holderIDs()[0]
+}
+
+// validateHolder makes sure a holder ID can name its mountpoint.
+func validateHolder(holder string) error {
+	if holder == SharedMountName || holder == "." || holder == ".." || strings.ContainsAny(holder, "/\\\x00") {
+		return fmt.Errorf("Invalid container ID '%s'", holder)
+	}
+	return nil
+}
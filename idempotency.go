@@ -0,0 +1,109 @@
+package localdriver
+
+import (
+	"context"
+	"time"
+
+	"code.cloudfoundry.org/dockerdriver"
+)
+
+// IdempotencyKeyOption is the Mount option that carries an idempotency key.
+const IdempotencyKeyOption = "idempotency_key"
+
+const (
+	operationMount   = "mount"
+	operationUnmount = "unmount"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the ID the caller sent along with
+// a request, such as the container ID docker sends with Mount and Unmount.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID stored by WithRequestID, if any.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+type idempotentCallKey struct {
+	volume string
+	key    string
+}
+
+type idempotentCall struct {
+	operation string
+	holder    string
+	response  interface{}
+	expiresAt time.Time
+}
+
+// idempotencyKey prefers an explicit key from the request options over the
+// request ID.
+func idempotencyKey(env dockerdriver.Env, opts map[string]interface{}) string {
+	if key, ok := opts[IdempotencyKeyOption].(string); ok && key != "" {
+		return key
+	}
+	return RequestID(env.Context())
+}
+
+// replay returns the response of the last successful call made for volume
+// with key, if that call was the same operation and the window has not
+// passed. A different operation with the same key is a new call, so a mount,
+// unmount and mount again by the same container all take effect.
+func (d *LocalDriver) replay(volume, key, operation string) (interface{}, bool) {
+	if d.idempotencyWindow <= 0 || key == "" {
+		return nil, false
+	}
+
+	now := d.clock.Now()
+	for k, call := range d.calls {
+		if !now.Before(call.expiresAt) {
+			delete(d.calls, k)
+		}
+	}
+
+	call, ok := d.calls[idempotentCallKey{volume: volume, key: key}]
+	if !ok || call.operation != operation {
+		return nil, false
+	}
+	return call.response, true
+}
+
+func (d *LocalDriver) remember(volume, key, holder, operation string, response interface{}) {
+	if d.idempotencyWindow <= 0 || key == "" {
+		return
+	}
+	d.calls[idempotentCallKey{volume: volume, key: key}] = &idempotentCall{
+		operation: operation,
+		holder:    holder,
+		response:  response,
+		expiresAt: d.clock.Now().Add(d.idempotencyWindow),
+	}
+}
+
+// forgetCalls drops the calls made for a volume, so that a volume created
+// again under the same name does not replay them.
+func (d *LocalDriver) forgetCalls(volume string) {
+	for k := range d.calls {
+		if k.volume == volume {
+			delete(d.calls, k)
+		}
+	}
+}
+
+// forgetHolderCalls drops the calls a holder made for a volume, so that a
+// mount the driver released on its own is not replayed when retried.
+func (d *LocalDriver) forgetHolderCalls(volume, holder string) {
+	for k, call := range d.calls {
+		if k.volume == volume && call.holder == holder {
+			delete(d.calls, k)
+		}
+	}
+}
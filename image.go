@@ -0,0 +1,130 @@
+package localdriver
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// BackendOption is the Create option that chooses how a volume is stored.
+const BackendOption = "backend"
+
+// BackendImage stores the volume as a sparse ext4 image file that is loop
+// mounted while the volume is mounted, so that the volume has a real size
+// limit.
+const BackendImage = "image"
+
+const (
+	imageFileName = "image"
+	imageMountDir = "fs"
+)
+
+func backendFromOpts(opts map[string]interface{}) (string, error) {
+	switch value := opts[BackendOption]; value {
+	case nil, "directory":
+		return "", nil
+	case BackendImage:
+		return BackendImage, nil
+	default:
+		return "", fmt.Errorf("Invalid 'backend' option: %v", value)
+	}
+}
+
+// dataPath is the directory holding the contents of the volume in
+// volumePath.
+func (d *LocalDriver) dataPath(vol *LocalVolumeInfo, volumePath string) string {
+	if vol.Backend == BackendImage {
+		return d.filepath.Join(volumePath, imageMountDir)
+	}
+	return volumePath
+}
+
+// createImageVolume creates and formats the image of vol, and mounts it once
+// to set the owner and mode of its root. This also tells the caller right
+// away when loop devices are not available.
+func (d *LocalDriver) createImageVolume(logger lager.Logger, vol *LocalVolumeInfo, volumePath string, owner ownership) error {
+	logger = logger.Session("create-image-volume", lager.Data{"volume": volumePath, "size": vol.Size})
+
+	// only the root of the image gets the requested owner and mode, the
+	// directories around it must stay reachable for the owner to get there
+	if err := d.mkdirAll(d.dataPath(vol, volumePath), DefaultVolumeMode); err != nil {
+		return err
+	}
+
+	err := d.osHelper.CreateImage(d.filepath.Join(volumePath, imageFileName), vol.Size)
+	if err == nil {
+		err = d.attachImage(logger, vol, volumePath)
+	}
+	if err == nil {
+		err = d.applyOwnership(vol, d.dataPath(vol, volumePath), owner)
+		if detachErr := d.detachImage(logger, vol, volumePath); err == nil {
+			err = detachErr
+		}
+	}
+
+	// never remove an image that is still mounted, that would empty it
+	// first; it is left for cleanupStrayImage instead
+	if err != nil && vol.ImageMounted {
+		logger.Info("leaving-stray-image", lager.Data{"volume": volumePath})
+		d.strayImages[volumePath] = true
+	} else if err != nil {
+		d.os.RemoveAll(volumePath)
+	}
+	return err
+}
+
+// cleanupStrayImage unmounts and removes the image a failed Create could not
+// unmount, if there is one at volumePath. The reaper retries it, and so does
+// a Create of a volume at the same path.
+func (d *LocalDriver) cleanupStrayImage(logger lager.Logger, volumePath string) error {
+	mounted, ok := d.strayImages[volumePath]
+	if !ok {
+		return nil
+	}
+	logger = logger.Session("cleanup-stray-image", lager.Data{"volume": volumePath})
+
+	if mounted {
+		if err := d.osHelper.Unmount(d.filepath.Join(volumePath, imageMountDir)); err != nil {
+			logger.Error("failed-unmounting-image", err)
+			return err
+		}
+		d.strayImages[volumePath] = false
+	}
+	if err := d.os.RemoveAll(volumePath); err != nil {
+		logger.Error("failed-removing-image", err)
+		return err
+	}
+	delete(d.strayImages, volumePath)
+	return nil
+}
+
+// cleanupStrayImages retries cleanupStrayImage for every image left by a
+// failed Create.
+func (d *LocalDriver) cleanupStrayImages(logger lager.Logger) []string {
+	var errs []string
+	for volumePath := range d.strayImages {
+		if err := d.cleanupStrayImage(logger, volumePath); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	return errs
+}
+
+func (d *LocalDriver) attachImage(logger lager.Logger, vol *LocalVolumeInfo, volumePath string) error {
+	logger.Info("mount-image", lager.Data{"volume": volumePath})
+	if err := d.osHelper.MountImage(d.filepath.Join(volumePath, imageFileName), d.dataPath(vol, volumePath)); err != nil {
+		return err
+	}
+	vol.ImageMounted = true
+	return nil
+}
+
+func (d *LocalDriver) detachImage(logger lager.Logger, vol *LocalVolumeInfo, volumePath string) error {
+	logger.Info("unmount-image", lager.Data{"volume": volumePath})
+	if err := d.osHelper.Unmount(d.dataPath(vol, volumePath)); err != nil {
+		logger.Error("failed-unmounting-image", err)
+		return err
+	}
+	vol.ImageMounted = false
+	return nil
+}
@@ -0,0 +1,70 @@
+package localdriver
+
+import (
+	"fmt"
+	"sort"
+
+	"code.cloudfoundry.org/dockerdriver"
+)
+
+type ListVolumesRequest struct {
+	// Labels restricts the result to volumes carrying all of the given
+	// labels with the given values.
+	Labels map[string]string
+}
+
+func labelsFromOpts(opts map[string]interface{}) (map[string]string, error) {
+	raw, ok := opts["labels"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	switch labels := raw.(type) {
+	case map[string]string:
+		result := make(map[string]string, len(labels))
+		for key, value := range labels {
+			result[key] = value
+		}
+		return result, nil
+	case map[string]interface{}:
+		result := make(map[string]string, len(labels))
+		for key, value := range labels {
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("Invalid 'labels' option: value of label '%s' is not a string", key)
+			}
+			result[key] = s
+		}
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("Invalid 'labels' option: expected a map of strings")
+}
+
+func (v *LocalVolumeInfo) hasLabels(labels map[string]string) bool {
+	for key, value := range labels {
+		if actual, ok := v.Labels[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ListVolumes is List with filtering, for the admin API. Volumes are sorted
+// by name.
+func (d *LocalDriver) ListVolumes(env dockerdriver.Env, listRequest ListVolumesRequest) dockerdriver.ListResponse {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	listResponse := dockerdriver.ListResponse{Volumes: []dockerdriver.VolumeInfo{}}
+	capacities := map[string]PoolCapacity{}
+	for _, volume := range d.volumes {
+		if volume.hasLabels(listRequest.Labels) {
+			listResponse.Volumes = append(listResponse.Volumes, d.volumeInfo(volume, capacities))
+		}
+	}
+	sort.Slice(listResponse.Volumes, func(i, j int) bool {
+		return listResponse.Volumes[i].Name < listResponse.Volumes[j].Name
+	})
+	return listResponse
+}
@@ -0,0 +1,131 @@
+package localdriver
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const LayersRootDir = "_layers"
+
+// CopyOnWriteOption is the Mount option that gives the holder a private
+// writable layer on top of the volume, thrown away on Unmount.
+const CopyOnWriteOption = "copy_on_write"
+
+const (
+	// LayerOverlay is an overlayfs mount with the volume as its lower dir.
+	LayerOverlay = "overlay"
+	// LayerCopy is a full copy of the volume, used where overlayfs cannot be
+	// mounted.
+	LayerCopy = "copy"
+)
+
+func copyOnWriteFromOpts(opts map[string]interface{}) (bool, error) {
+	switch value := opts[CopyOnWriteOption].(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return value, nil
+	case string:
+		copyOnWrite, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf("Invalid 'copy_on_write' option: %s", value)
+		}
+		return copyOnWrite, nil
+	default:
+		return false, fmt.Errorf("Invalid 'copy_on_write' option: %v", value)
+	}
+}
+
+func (d *LocalDriver) layerPath(logger lager.Logger, root, volumeId, holder string) string {
+	dir, err := d.filepath.Abs(root)
+	if err != nil {
+		logger.Fatal("abs-failed", err)
+	}
+	return d.filepath.Join(dir, LayersRootDir, volumeId, holder)
+}
+
+// createLayer builds a private writable layer for holder over lower in
+// layerPath. It mounts an overlay where the system allows it and copies lower
+// otherwise, and returns the directory to mount along with the kind of layer.
+// It is called with the driver lock held, and lets go of it while copying, so
+// that a large volume does not hold up calls for other volumes; meanwhile
+// the copy is recorded in vol.layerCopies.
+func (d *LocalDriver) createLayer(logger lager.Logger, vol *LocalVolumeInfo, holder, layerPath, lower string) (string, string, error) {
+	logger = logger.Session("create-layer", lager.Data{"layer": layerPath, "lower": lower})
+
+	upper := d.filepath.Join(layerPath, "upper")
+	work := d.filepath.Join(layerPath, "work")
+	merged := d.filepath.Join(layerPath, "merged")
+	for _, dir := range []string{upper, work, merged} {
+		if err := d.mkdirAll(dir, os.ModePerm); err != nil {
+			d.os.RemoveAll(layerPath)
+			return "", "", err
+		}
+	}
+
+	err := d.osHelper.MountOverlay(lower, upper, work, merged)
+	if err == nil {
+		logger.Info("mounted-overlay")
+		return merged, LayerOverlay, nil
+	}
+	logger.Info("overlay-unavailable-copying", lager.Data{"reason": err.Error()})
+
+	if err := d.os.RemoveAll(layerPath); err != nil {
+		return "", "", err
+	}
+	if err := d.mkdirAll(layerPath, os.ModePerm); err != nil {
+		return "", "", err
+	}
+	copied := d.filepath.Join(layerPath, "copy")
+
+	if vol.layerCopies == nil {
+		vol.layerCopies = map[string]bool{}
+	}
+	vol.layerCopies[holder] = true
+	d.lock.Unlock()
+	// without overlayfs the driver is usually unprivileged, and cannot give
+	// the copy of a container's files their owner
+	err = d.copyTree(lower, copied, true)
+	d.lock.Lock()
+	delete(vol.layerCopies, holder)
+
+	if err != nil {
+		d.os.RemoveAll(layerPath)
+		return "", "", err
+	}
+	return copied, LayerCopy, nil
+}
+
+// removeLayer throws a holder's layer away. An overlay that cannot be
+// unmounted is left in place, since removing it would reach through to the
+// volume.
+func (d *LocalDriver) removeLayer(logger lager.Logger, layerPath, layer string) {
+	logger = logger.Session("remove-layer", lager.Data{"layer": layerPath})
+
+	if layer == LayerOverlay {
+		if err := d.osHelper.Unmount(d.filepath.Join(layerPath, "merged")); err != nil {
+			logger.Error("failed-unmounting-overlay", err)
+			return
+		}
+	}
+	if err := d.os.RemoveAll(layerPath); err != nil {
+		logger.Error("failed-removing-layer", err)
+		return
+	}
+	// only succeeds once the volume's last layer is gone
+	d.os.Remove(d.filepath.Dir(layerPath))
+}
+
+// layers maps each holder with a copy-on-write layer to the kind of layer.
+func (vol *LocalVolumeInfo) layers() map[string]string {
+	layers := map[string]string{}
+	for id, holder := range vol.Holders {
+		if holder.Layer != "" {
+			layers[id] = holder.Layer
+		}
+	}
+	return layers
+}
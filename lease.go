@@ -0,0 +1,114 @@
+package localdriver
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// LeaseOption is the Mount option that asks for the mount to be released
+// unless its holder renews it within the given duration.
+const LeaseOption = "lease"
+
+type HeartbeatRequest struct {
+	Name   string
+	Holder string
+}
+
+// ReleasedLease names a mount whose lease ran out.
+type ReleasedLease struct {
+	Volume string
+	Holder string
+}
+
+func (h MountHolder) leaseExpired(now time.Time) bool {
+	return !h.LeaseExpiresAt.IsZero() && !now.Before(h.LeaseExpiresAt)
+}
+
+// Heartbeat renews the lease the holder took out when it mounted the volume.
+func (d *LocalDriver) Heartbeat(env dockerdriver.Env, heartbeatRequest HeartbeatRequest) dockerdriver.ErrorResponse {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	logger := env.Logger().Session("heartbeat", lager.Data{"volume": heartbeatRequest.Name, "holder": heartbeatRequest.Holder})
+
+	if heartbeatRequest.Name == "" {
+		return dockerdriver.ErrorResponse{Err: "Missing mandatory 'volume_name'"}
+	}
+	if heartbeatRequest.Holder == "" {
+		return dockerdriver.ErrorResponse{Err: "Missing mandatory 'holder'"}
+	}
+
+	vol, ok := d.volumes[heartbeatRequest.Name]
+	if !ok {
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' not found", heartbeatRequest.Name)}
+	}
+
+	holder, ok := vol.Holders[heartbeatRequest.Holder]
+	if !ok {
+		errText := fmt.Sprintf("Volume '%s' is not mounted by '%s'", heartbeatRequest.Name, heartbeatRequest.Holder)
+		logger.Error("failed-not-a-holder", errors.New(errText))
+		return dockerdriver.ErrorResponse{Err: errText}
+	}
+	if holder.Lease == 0 {
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' was mounted by '%s' without a lease", heartbeatRequest.Name, heartbeatRequest.Holder)}
+	}
+
+	vol.renewLease(heartbeatRequest.Holder, d.clock.Now(), holder.Lease)
+	logger.Debug("lease-renewed", lager.Data{"expires_at": vol.Holders[heartbeatRequest.Holder].LeaseExpiresAt})
+	return dockerdriver.ErrorResponse{}
+}
+
+func (vol *LocalVolumeInfo) renewLease(id string, now time.Time, lease time.Duration) {
+	holder := vol.Holders[id]
+	holder.Lease = lease
+	holder.LeaseExpiresAt = now.Add(lease)
+	vol.Holders[id] = holder
+}
+
+// releaseExpiredLeases unmounts the holders whose lease has run out, removing
+// the mountpoint once nobody holds the volume any more, and forgets their
+// mounts so that a retry mounts the volume again.
+func (d *LocalDriver) releaseExpiredLeases(logger lager.Logger, now time.Time) ([]ReleasedLease, []string) {
+	var released []ReleasedLease
+	var errs []string
+	for _, vol := range d.volumes {
+		for _, id := range vol.holderIDs() {
+			holder := vol.Holders[id]
+			if !holder.leaseExpired(now) {
+				continue
+			}
+
+			logger.Info("lease-expired", lager.Data{"volume": vol.Name, "holder": id, "expired_at": holder.LeaseExpiresAt})
+			if response := d.unmount(logger, vol.Name, id); response.Err != "" {
+				errs = append(errs, response.Err)
+				continue
+			}
+			d.forgetHolderCalls(vol.Name, id)
+			released = append(released, ReleasedLease{Volume: vol.Name, Holder: id})
+		}
+	}
+
+	sort.Slice(released, func(i, j int) bool {
+		if released[i].Volume != released[j].Volume {
+			return released[i].Volume < released[j].Volume
+		}
+		return released[i].Holder < released[j].Holder
+	})
+	return released, errs
+}
+
+// leaseExpiries maps each holder with a lease to the time the lease runs out.
+func (vol *LocalVolumeInfo) leaseExpiries() map[string]string {
+	expiries := map[string]string{}
+	for id, holder := range vol.Holders {
+		if !holder.LeaseExpiresAt.IsZero() {
+			expiries[id] = holder.LeaseExpiresAt.UTC().Format(time.RFC3339)
+		}
+	}
+	return expiries
+}
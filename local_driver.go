@@ -6,7 +6,10 @@ import (
 	"os"
 
 	"strings"
+	"sync"
+	"time"
 
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/dockerdriver"
 	dockerdriverutils "code.cloudfoundry.org/dockerdriver/utils"
 	"code.cloudfoundry.org/goshims/filepathshim"
@@ -19,41 +22,158 @@ const MountsRootDir = "_mounts"
 
 type LocalVolumeInfo struct {
 	dockerdriver.VolumeInfo // see dockerdriver.resources.go
+	Pool                    string
+	Labels                  map[string]string
+	ExpiresAt               time.Time
+	// Holders are the callers that mounted the volume with an ID, keyed by
+	// that ID. MountCount also counts mounts by callers without one.
+	Holders map[string]MountHolder
+	// UID, GID and Mode describe the volume root as it was created.
+	UID  int
+	GID  int
+	Mode os.FileMode
+	// Medium is MediumMemory for volumes kept in memory and empty for volumes
+	// on disk. Size caps the volume, when it is capped.
+	Medium string
+	Size   uint64
+	// MemoryDir is the shared memory directory holding a memory volume that
+	// could not get a tmpfs of its own.
+	MemoryDir string
+	// Backend is BackendImage for volumes stored in an image file, and
+	// ImageMounted tells whether that image is mounted.
+	Backend      string
+	ImageMounted bool
+	// moving is set while Move copies the volume to another pool, and
+	// layerCopies holds the holders whose copy-on-write layer is being copied
+	// from the volume.
+	moving      bool
+	layerCopies map[string]bool
+}
+
+type FilesystemStats struct {
+	TotalBytes  uint64
+	FreeBytes   uint64
+	TotalInodes uint64
+	FreeInodes  uint64
 }
 
 type OsHelper interface {
-	Umask(mask int) (oldmask int)
+	Statfs(path string) (FilesystemStats, error)
+	MountOverlay(lower, upper, work, target string) error
+	MountTmpfs(target string, size uint64) error
+	CreateImage(image string, size uint64) error
+	MountImage(image, target string) error
+	ResizeImage(image string, size uint64) error
+	ResizeTmpfs(target string, size uint64) error
+	Unmount(target string) error
+}
+
+type Config struct {
+	// Pools lists the mount roots volumes can be placed in. The first pool is
+	// used for volumes whose pool is unknown.
+	Pools           []Pool
+	Placement       PlacementPolicy
+	UniqueVolumeIds bool
+	// TrashRetention enables soft delete: removed volumes are kept in the
+	// pool's trash for this long before they are purged.
+	TrashRetention time.Duration
+	// Leases enables the 'lease' mount option. A lease is only renewed by
+	// Heartbeat and only released by ReapExpired, so set it only when both
+	// are in use.
+	Leases bool
+	// IdempotencyWindow is how long a Mount or Unmount that carries an
+	// idempotency key is remembered, so that a retry returns the original
+	// response instead of changing the mount count again. Zero disables it.
+	IdempotencyWindow time.Duration
+	// SharedMemoryDir holds memory volumes where tmpfs cannot be mounted. It
+	// defaults to DefaultSharedMemoryDir.
+	SharedMemoryDir string
+	// MaxMemoryVolumeSize caps memory volumes and is the size of those
+	// created without a 'size' option. It defaults to
+	// DefaultMaxMemoryVolumeSize.
+	MaxMemoryVolumeSize uint64
+	// MinFreeBytes and MinFreeInodes make Create refuse pools whose
+	// filesystem has less room left. Zero disables the check.
+	MinFreeBytes  uint64
+	MinFreeInodes uint64
+	// Clock defaults to the system clock.
+	Clock clock.Clock
 }
 
 type LocalDriver struct {
-	volumes         map[string]*LocalVolumeInfo
-	os              osshim.Os
-	filepath        filepathshim.Filepath
-	mountPathRoot   string
-	osHelper        OsHelper
-	uniqueVolumeIds bool
+	lock                sync.Mutex
+	volumes             map[string]*LocalVolumeInfo
+	os                  osshim.Os
+	filepath            filepathshim.Filepath
+	pools               []Pool
+	poolUsages          map[string]poolUsage
+	placement           PlacementPolicy
+	nextPool            int
+	osHelper            OsHelper
+	uniqueVolumeIds     bool
+	trash               map[string]*TrashedVolume
+	strayImages         map[string]bool
+	trashRetention      time.Duration
+	leases              bool
+	idempotencyWindow   time.Duration
+	calls               map[idempotentCallKey]*idempotentCall
+	sharedMemoryDir     string
+	maxMemoryVolumeSize uint64
+	minFreeBytes        uint64
+	minFreeInodes       uint64
+	clock               clock.Clock
 }
 
 func NewLocalDriver(os osshim.Os, filepath filepathshim.Filepath, mountPathRoot string, osHelper OsHelper, uniqueVolumeIds bool) *LocalDriver {
-	return &LocalDriver{
-		volumes:         map[string]*LocalVolumeInfo{},
-		os:              os,
-		filepath:        filepath,
-		mountPathRoot:   mountPathRoot,
-		osHelper:        osHelper,
-		uniqueVolumeIds: uniqueVolumeIds,
-	}
+	return NewLocalDriverWithState(map[string]*LocalVolumeInfo{}, os, filepath, mountPathRoot, osHelper, uniqueVolumeIds)
 }
 
 func NewLocalDriverWithState(state map[string]*LocalVolumeInfo, os osshim.Os, filepath filepathshim.Filepath, mountPathRoot string, osHelper OsHelper, uniqueVolumeIds bool) *LocalDriver {
-	return &LocalDriver{
-		volumes:         state,
-		os:              os,
-		filepath:        filepath,
-		mountPathRoot:   mountPathRoot,
-		osHelper:        osHelper,
-		uniqueVolumeIds: uniqueVolumeIds,
-	}
+	// a single default pool is always a valid configuration
+	d, _ := NewLocalDriverWithConfig(state, os, filepath, osHelper, Config{
+		Pools:           []Pool{{Name: DefaultPoolName, Path: mountPathRoot}},
+		UniqueVolumeIds: uniqueVolumeIds,
+	})
+	return d
+}
+
+func NewLocalDriverWithConfig(state map[string]*LocalVolumeInfo, os osshim.Os, filepath filepathshim.Filepath, osHelper OsHelper, config Config) (*LocalDriver, error) {
+	if err := validatePools(config.Pools, config.Placement); err != nil {
+		return nil, err
+	}
+	if config.Clock == nil {
+		config.Clock = clock.NewClock()
+	}
+	if config.SharedMemoryDir == "" {
+		config.SharedMemoryDir = DefaultSharedMemoryDir
+	}
+	if config.MaxMemoryVolumeSize == 0 {
+		config.MaxMemoryVolumeSize = DefaultMaxMemoryVolumeSize
+	}
+
+	d := &LocalDriver{
+		volumes:             state,
+		os:                  os,
+		filepath:            filepath,
+		pools:               config.Pools,
+		poolUsages:          map[string]poolUsage{},
+		placement:           config.Placement,
+		osHelper:            osHelper,
+		uniqueVolumeIds:     config.UniqueVolumeIds,
+		trash:               map[string]*TrashedVolume{},
+		strayImages:         map[string]bool{},
+		trashRetention:      config.TrashRetention,
+		leases:              config.Leases,
+		idempotencyWindow:   config.IdempotencyWindow,
+		calls:               map[idempotentCallKey]*idempotentCall{},
+		sharedMemoryDir:     config.SharedMemoryDir,
+		maxMemoryVolumeSize: config.MaxMemoryVolumeSize,
+		minFreeBytes:        config.MinFreeBytes,
+		minFreeInodes:       config.MinFreeInodes,
+		clock:               config.Clock,
+	}
+	d.recoverTrash()
+	return d, nil
 }
 
 func (d *LocalDriver) Activate(_ dockerdriver.Env) dockerdriver.ActivateResponse {
@@ -63,6 +183,9 @@ func (d *LocalDriver) Activate(_ dockerdriver.Env) dockerdriver.ActivateResponse
 }
 
 func (d *LocalDriver) Create(env dockerdriver.Env, createRequest dockerdriver.CreateRequest) dockerdriver.ErrorResponse {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
 	logger := env.Logger().Session("create")
 	var ok bool
 	if createRequest.Name == "" {
@@ -71,17 +194,104 @@ func (d *LocalDriver) Create(env dockerdriver.Env, createRequest dockerdriver.Cr
 
 	var existingVolume *LocalVolumeInfo
 	if existingVolume, ok = d.volumes[createRequest.Name]; !ok {
-		logger.Info("creating-volume", lager.Data{"volume_name": createRequest.Name, "volume_id": createRequest.Name})
-		volInfo := LocalVolumeInfo{VolumeInfo: dockerdriver.VolumeInfo{Name: createRequest.Name}}
-		d.volumes[createRequest.Name] = &volInfo
+		labels, err := labelsFromOpts(createRequest.Opts)
+		if err != nil {
+			logger.Error("invalid-labels", err, lager.Data{"volume_name": createRequest.Name})
+			return dockerdriver.ErrorResponse{Err: err.Error()}
+		}
+
+		ttl, err := ttlFromOpts(createRequest.Opts)
+		if err != nil {
+			logger.Error("invalid-ttl", err, lager.Data{"volume_name": createRequest.Name})
+			return dockerdriver.ErrorResponse{Err: err.Error()}
+		}
+
+		owner, err := ownershipFromOpts(createRequest.Opts)
+		if err != nil {
+			logger.Error("invalid-ownership", err, lager.Data{"volume_name": createRequest.Name})
+			return dockerdriver.ErrorResponse{Err: err.Error()}
+		}
 
-		createDir := d.volumePath(logger, createRequest.Name)
-		logger.Info("creating-volume-folder", lager.Data{"volume": createDir})
-		orig := d.osHelper.Umask(000)
-		defer d.osHelper.Umask(orig)
-		err := d.os.MkdirAll(createDir, os.ModePerm)
+		medium, err := mediumFromOpts(createRequest.Opts)
 		if err != nil {
-			logger.Fatal("failed-creating-path", err, lager.Data{"path": createDir})
+			logger.Error("invalid-medium", err, lager.Data{"volume_name": createRequest.Name})
+			return dockerdriver.ErrorResponse{Err: err.Error()}
+		}
+		backend, err := backendFromOpts(createRequest.Opts)
+		if err != nil {
+			logger.Error("invalid-backend", err, lager.Data{"volume_name": createRequest.Name})
+			return dockerdriver.ErrorResponse{Err: err.Error()}
+		}
+		if backend == BackendImage && medium == MediumMemory {
+			return dockerdriver.ErrorResponse{Err: "The 'image' backend cannot be used with the 'memory' medium"}
+		}
+		size, err := sizeFromOpts(createRequest.Opts)
+		sizeAsked := size > 0
+		switch {
+		case err != nil:
+		case medium == MediumMemory:
+			size, err = d.memorySize(size)
+		case backend == BackendImage && size == 0:
+			err = errors.New("The 'image' backend requires the 'size' option")
+		case backend == "" && size > 0:
+			err = errors.New("The 'size' option requires the 'memory' medium or the 'image' backend")
+		}
+		if err != nil {
+			logger.Error("invalid-size", err, lager.Data{"volume_name": createRequest.Name})
+			return dockerdriver.ErrorResponse{Err: err.Error()}
+		}
+
+		pool, err := d.placeVolume(logger, createRequest.Opts)
+		if err != nil {
+			logger.Error("failed-placing-volume", err, lager.Data{"volume_name": createRequest.Name})
+			return dockerdriver.ErrorResponse{Err: err.Error()}
+		}
+
+		createDir := d.volumePath(logger, pool.Path, createRequest.Name)
+		if err := d.cleanupStrayImage(logger, createDir); err != nil {
+			return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Failed cleaning up the image left by an earlier create: %s", err)}
+		}
+
+		logger.Info("creating-volume", lager.Data{"volume_name": createRequest.Name, "volume_id": createRequest.Name, "pool": pool.Name})
+		volInfo := LocalVolumeInfo{VolumeInfo: dockerdriver.VolumeInfo{Name: createRequest.Name}, Pool: pool.Name, Labels: labels, Medium: medium, Size: size, Backend: backend}
+		if ttl > 0 {
+			volInfo.ExpiresAt = d.clock.Now().Add(ttl)
+		}
+		d.volumes[createRequest.Name] = &volInfo
+
+		logger.Info("creating-volume-folder", lager.Data{"volume": createDir, "medium": medium, "backend": backend})
+		switch {
+		case medium == MediumMemory:
+			if err := d.createMemoryVolume(logger, &volInfo, createDir, owner.mode, sizeAsked); err != nil {
+				logger.Error("failed-creating-memory-volume", err, lager.Data{"path": createDir})
+				delete(d.volumes, createRequest.Name)
+				return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Failed creating memory volume: %s", err)}
+			}
+		case backend == BackendImage:
+			// the image is only mounted while the volume is, so the
+			// ownership is applied while creating it
+			if err := d.createImageVolume(logger, &volInfo, createDir, owner); err != nil {
+				logger.Error("failed-creating-image-volume", err, lager.Data{"path": createDir})
+				delete(d.volumes, createRequest.Name)
+				return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Failed creating image volume: %s", err)}
+			}
+			return dockerdriver.ErrorResponse{}
+		default:
+			err = d.os.MkdirAll(createDir, owner.mode)
+			if err != nil {
+				logger.Fatal("failed-creating-path", err, lager.Data{"path": createDir})
+			}
+		}
+
+		if err := d.applyOwnership(&volInfo, createDir, owner); err != nil {
+			logger.Error("failed-setting-ownership", err, lager.Data{"path": createDir})
+			if medium == MediumMemory {
+				d.removeMemoryVolume(logger, &volInfo, createDir)
+			} else {
+				d.os.RemoveAll(createDir)
+			}
+			delete(d.volumes, createRequest.Name)
+			return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Failed setting ownership of volume: %s", err)}
 		}
 
 		return dockerdriver.ErrorResponse{}
@@ -96,15 +306,22 @@ func (d *LocalDriver) Create(env dockerdriver.Env, createRequest dockerdriver.Cr
 }
 
 func (d *LocalDriver) List(env dockerdriver.Env) dockerdriver.ListResponse {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
 	listResponse := dockerdriver.ListResponse{}
+	capacities := map[string]PoolCapacity{}
 	for _, volume := range d.volumes {
-		listResponse.Volumes = append(listResponse.Volumes, volume.VolumeInfo)
+		listResponse.Volumes = append(listResponse.Volumes, d.volumeInfo(volume, capacities))
 	}
 	listResponse.Err = ""
 	return listResponse
 }
 
 func (d *LocalDriver) Mount(env dockerdriver.Env, mountRequest dockerdriver.MountRequest) dockerdriver.MountResponse {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
 	logger := env.Logger().Session("mount", lager.Data{"volume": mountRequest.Name})
 
 	if mountRequest.Name == "" {
@@ -117,7 +334,18 @@ func (d *LocalDriver) Mount(env dockerdriver.Env, mountRequest dockerdriver.Moun
 		return dockerdriver.MountResponse{Err: fmt.Sprintf("Volume '%s' must be created before being mounted", mountRequest.Name)}
 	}
 
-	volumePath := d.volumePath(logger, vol.Name)
+	key := idempotencyKey(env, mountRequest.Opts)
+	if response, ok := d.replay(vol.Name, key, operationMount); ok {
+		logger.Info("replaying-mount", lager.Data{"key": key})
+		return response.(dockerdriver.MountResponse)
+	}
+
+	if vol.moving {
+		return dockerdriver.MountResponse{Err: fmt.Sprintf("Volume '%s' is being moved", vol.Name)}
+	}
+
+	root := d.volumePool(vol).Path
+	volumePath := d.volumePath(logger, root, vol.Name)
 
 	exists, err := d.exists(volumePath)
 	if err != nil {
@@ -130,26 +358,115 @@ func (d *LocalDriver) Mount(env dockerdriver.Env, mountRequest dockerdriver.Moun
 		return dockerdriver.MountResponse{Err: "Volume '" + mountRequest.Name + "' is missing"}
 	}
 
-	mountPath := d.mountPath(logger, vol.Name)
-	logger.Info("mounting-volume", lager.Data{"id": vol.Name, "mountpoint": mountPath})
+	holder := RequestID(env.Context())
+	lease, err := durationFromOpts(mountRequest.Opts, LeaseOption)
+	if err != nil {
+		logger.Error("invalid-lease", err)
+		return dockerdriver.MountResponse{Err: err.Error()}
+	}
+	if lease > 0 && !d.leases {
+		return dockerdriver.MountResponse{Err: "The 'lease' option is not enabled on this driver"}
+	}
+	if lease > 0 && holder == "" {
+		return dockerdriver.MountResponse{Err: "The 'lease' option requires the ID of the mounting container"}
+	}
+	subpath, err := subpathFromOpts(mountRequest.Opts)
+	if err != nil {
+		logger.Error("invalid-subpath", err)
+		return dockerdriver.MountResponse{Err: err.Error()}
+	}
+	if subpath != "" && holder == "" {
+		return dockerdriver.MountResponse{Err: "The 'subpath' option requires the ID of the mounting container"}
+	}
+	copyOnWrite, err := copyOnWriteFromOpts(mountRequest.Opts)
+	if err != nil {
+		logger.Error("invalid-copy-on-write", err)
+		return dockerdriver.MountResponse{Err: err.Error()}
+	}
+	if copyOnWrite && holder == "" {
+		return dockerdriver.MountResponse{Err: "The 'copy_on_write' option requires the ID of the mounting container"}
+	}
+	if err := validateHolder(holder); err != nil {
+		logger.Error("invalid-holder", err)
+		return dockerdriver.MountResponse{Err: err.Error()}
+	}
+
+	mountPath := d.mountPath(logger, root, vol.Name, holder)
+	if vol.holds(holder) {
+		logger.Info("already-mounted-by-holder", lager.Data{"holder": holder, "count": vol.MountCount})
+		if held := vol.Holders[holder].Subpath; held != subpath {
+			return dockerdriver.MountResponse{Err: fmt.Sprintf("Volume '%s' is already mounted by '%s' at subpath '%s'", vol.Name, holder, held)}
+		}
+		if held := vol.Holders[holder].Layer != ""; held != copyOnWrite {
+			return dockerdriver.MountResponse{Err: fmt.Sprintf("Volume '%s' is already mounted by '%s' with copy_on_write %t", vol.Name, holder, held)}
+		}
+		if lease > 0 {
+			vol.renewLease(holder, d.clock.Now(), lease)
+		}
+		return dockerdriver.MountResponse{Mountpoint: mountPath}
+	}
+	if vol.layerCopies[holder] {
+		return dockerdriver.MountResponse{Err: fmt.Sprintf("Volume '%s' is already being mounted by '%s'", vol.Name, holder)}
+	}
+
+	logger.Info("mounting-volume", lager.Data{"id": vol.Name, "mountpoint": mountPath, "holder": holder})
+
+	if vol.Backend == BackendImage && !vol.ImageMounted {
+		if err := d.attachImage(logger, vol, volumePath); err != nil {
+			logger.Error("mount-volume-failed", err)
+			return dockerdriver.MountResponse{Err: fmt.Sprintf("Error mounting volume image: %s", err.Error())}
+		}
+		defer func() {
+			if vol.MountCount == 0 && len(vol.layerCopies) == 0 {
+				d.detachImage(logger, vol, volumePath)
+			}
+		}()
+	}
+
+	// callers without an ID share one mountpoint, every holder gets its own
+	layer := ""
+	if holder != "" || vol.anonymousMounts() < 1 {
+		target := d.dataPath(vol, volumePath)
+		if subpath != "" {
+			target, err = d.subpathTarget(logger, vol, target, subpath)
+			if err != nil {
+				logger.Error("mount-volume-failed", err)
+				return dockerdriver.MountResponse{Err: err.Error()}
+			}
+		}
 
-	if vol.MountCount < 1 {
-		err := d.mount(logger, volumePath, mountPath)
+		if copyOnWrite {
+			target, layer, err = d.createLayer(logger, vol, holder, d.layerPath(logger, root, vol.Name, holder), target)
+			if err != nil {
+				logger.Error("mount-volume-failed", err)
+				return dockerdriver.MountResponse{Err: fmt.Sprintf("Error creating copy-on-write layer: %s", err.Error())}
+			}
+		}
+
+		err := d.mount(logger, target, mountPath)
 		if err != nil {
+			if layer != "" {
+				d.removeLayer(logger, d.layerPath(logger, root, vol.Name, holder), layer)
+			}
 			logger.Error("mount-volume-failed", err)
 			return dockerdriver.MountResponse{Err: fmt.Sprintf("Error mounting volume: %s", err.Error())}
 		}
-		vol.Mountpoint = mountPath
 	}
 
+	vol.Mountpoint = mountPath
 	vol.MountCount++
+	vol.addHolder(holder, MountHolder{MountedAt: d.clock.Now(), Lease: lease, Subpath: subpath, Layer: layer})
 	logger.Info("volume-mounted", lager.Data{"name": vol.Name, "count": vol.MountCount})
 
-	mountResponse := dockerdriver.MountResponse{Mountpoint: vol.Mountpoint}
+	mountResponse := dockerdriver.MountResponse{Mountpoint: mountPath}
+	d.remember(vol.Name, key, holder, operationMount, mountResponse)
 	return mountResponse
 }
 
 func (d *LocalDriver) Path(env dockerdriver.Env, pathRequest dockerdriver.PathRequest) dockerdriver.PathResponse {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
 	logger := env.Logger().Session("path", lager.Data{"volume": pathRequest.Name})
 
 	if pathRequest.Name == "" {
@@ -173,6 +490,9 @@ func (d *LocalDriver) Path(env dockerdriver.Env, pathRequest dockerdriver.PathRe
 }
 
 func (d *LocalDriver) Unmount(env dockerdriver.Env, unmountRequest dockerdriver.UnmountRequest) dockerdriver.ErrorResponse {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
 	logger := env.Logger().Session("unmount", lager.Data{"volume": unmountRequest.Name})
 
 	if unmountRequest.Name == "" {
@@ -186,16 +506,40 @@ func (d *LocalDriver) Unmount(env dockerdriver.Env, unmountRequest dockerdriver.
 		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' not found", unmountRequest.Name)}
 	}
 
+	key := idempotencyKey(env, nil)
+	if response, ok := d.replay(unmountRequest.Name, key, operationUnmount); ok {
+		logger.Info("replaying-unmount", lager.Data{"key": key})
+		return response.(dockerdriver.ErrorResponse)
+	}
+
 	if mountPath == "" {
 		errText := "Volume not previously mounted"
 		logger.Error("failed-mountpoint-not-assigned", errors.New(errText))
 		return dockerdriver.ErrorResponse{Err: errText}
 	}
 
-	return d.unmount(logger, unmountRequest.Name, mountPath)
+	vol := d.volumes[unmountRequest.Name]
+	holder := RequestID(env.Context())
+	if !vol.holds(holder) && vol.anonymousMounts() < 1 {
+		errText := fmt.Sprintf("Volume '%s' is not mounted by '%s'", unmountRequest.Name, holder)
+		if holder == "" {
+			errText = fmt.Sprintf("Volume '%s' is mounted by %s; unmount it with the holder's ID", unmountRequest.Name, strings.Join(vol.holderIDs(), ", "))
+		}
+		logger.Error("failed-not-a-holder", errors.New(errText), lager.Data{"holder": holder})
+		return dockerdriver.ErrorResponse{Err: errText}
+	}
+
+	response := d.unmount(logger, unmountRequest.Name, holder)
+	if response.Err == "" {
+		d.remember(unmountRequest.Name, key, holder, operationUnmount, response)
+	}
+	return response
 }
 
 func (d *LocalDriver) Remove(env dockerdriver.Env, removeRequest dockerdriver.RemoveRequest) dockerdriver.ErrorResponse {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
 	logger := env.Logger().Session("remove", lager.Data{"volume": removeRequest})
 	logger.Info("start")
 	defer logger.Info("end")
@@ -212,14 +556,52 @@ func (d *LocalDriver) Remove(env dockerdriver.Env, removeRequest dockerdriver.Re
 		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' not found", removeRequest.Name)}
 	}
 
+	if len(vol.layerCopies) > 0 {
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' is being mounted", vol.Name)}
+	}
+
 	if vol.Mountpoint != "" {
-		response = d.unmount(logger, removeRequest.Name, vol.Mountpoint)
+		response = d.unmountAll(logger, vol)
 		if response.Err != "" {
 			return response
 		}
 	}
 
-	volumePath := d.volumePath(logger, vol.Name)
+	return d.removeVolume(logger, vol)
+}
+
+func (d *LocalDriver) removeVolume(logger lager.Logger, vol *LocalVolumeInfo) dockerdriver.ErrorResponse {
+	if vol.moving {
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' is being moved", vol.Name)}
+	}
+	if len(vol.layerCopies) > 0 {
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' is being mounted", vol.Name)}
+	}
+
+	volumePath := d.volumePath(logger, d.volumePool(vol).Path, vol.Name)
+	d.forgetCalls(vol.Name)
+
+	if vol.ImageMounted {
+		if err := d.detachImage(logger, vol, volumePath); err != nil {
+			return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Failed removing mount path: %s", err)}
+		}
+	}
+
+	// memory volumes are dropped for good, never kept in the trash
+	if vol.Medium == MediumMemory {
+		if err := d.removeMemoryVolume(logger, vol, volumePath); err != nil {
+			logger.Error("failed-removing-volume", err)
+			return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Failed removing mount path: %s", err)}
+		}
+
+		logger.Info("removing-volume", lager.Data{"name": vol.Name})
+		delete(d.volumes, vol.Name)
+		return dockerdriver.ErrorResponse{}
+	}
+
+	if d.trashRetention > 0 {
+		return d.trashVolume(logger, vol, volumePath)
+	}
 
 	logger.Info("remove-volume-folder", lager.Data{"volume": volumePath})
 	err := d.os.RemoveAll(volumePath)
@@ -228,19 +610,77 @@ func (d *LocalDriver) Remove(env dockerdriver.Env, removeRequest dockerdriver.Re
 		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Failed removing mount path: %s", err)}
 	}
 
-	logger.Info("removing-volume", lager.Data{"name": removeRequest.Name})
-	delete(d.volumes, removeRequest.Name)
+	logger.Info("removing-volume", lager.Data{"name": vol.Name})
+	delete(d.volumes, vol.Name)
 	return dockerdriver.ErrorResponse{}
 }
 
 func (d *LocalDriver) Get(env dockerdriver.Env, getRequest dockerdriver.GetRequest) dockerdriver.GetResponse {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
 	logger := env.Logger().Session("Get")
-	mountpoint, err := d.get(logger, getRequest.Name)
+	_, err := d.get(logger, getRequest.Name)
 	if err != nil {
 		return dockerdriver.GetResponse{Err: err.Error()}
 	}
 
-	return dockerdriver.GetResponse{Volume: dockerdriver.VolumeInfo{Name: getRequest.Name, Mountpoint: mountpoint}}
+	return dockerdriver.GetResponse{Volume: d.volumeInfo(d.volumes[getRequest.Name], map[string]PoolCapacity{})}
+}
+
+// volumeInfo describes vol. The capacity of its pool is looked up in
+// capacities, and added to it, so that listing many volumes runs statfs only
+// once per pool.
+func (d *LocalDriver) volumeInfo(vol *LocalVolumeInfo, capacities map[string]PoolCapacity) dockerdriver.VolumeInfo {
+	pool := d.volumePool(vol)
+	capacity, ok := capacities[pool.Name]
+	if !ok {
+		capacity = d.poolCapacity(pool)
+		capacities[pool.Name] = capacity
+	}
+
+	volumeInfo := vol.VolumeInfo
+	volumeInfo.Status = map[string]interface{}{
+		"pool":          pool.Name,
+		"pool_capacity": capacity,
+	}
+	if len(vol.Labels) > 0 {
+		volumeInfo.Status["labels"] = vol.Labels
+	}
+	if vol.Mode != 0 {
+		volumeInfo.Status["uid"] = vol.UID
+		volumeInfo.Status["gid"] = vol.GID
+		volumeInfo.Status["mode"] = fmt.Sprintf("%04o", uint32(vol.Mode.Perm()))
+	}
+	if vol.Medium != "" {
+		volumeInfo.Status["medium"] = vol.Medium
+	}
+	if vol.Medium == MediumMemory {
+		volumeInfo.Status["memory"] = vol.memoryBacking()
+	}
+	if vol.Backend != "" {
+		volumeInfo.Status["backend"] = vol.Backend
+	}
+	if vol.Size > 0 {
+		volumeInfo.Status["size"] = vol.Size
+	}
+	if len(vol.Holders) > 0 {
+		volumeInfo.Status["holders"] = vol.holderIDs()
+		if leases := vol.leaseExpiries(); len(leases) > 0 {
+			volumeInfo.Status["lease_expires_at"] = leases
+		}
+		if subpaths := vol.subpaths(); len(subpaths) > 0 {
+			volumeInfo.Status["subpaths"] = subpaths
+		}
+		if layers := vol.layers(); len(layers) > 0 {
+			volumeInfo.Status["layers"] = layers
+		}
+	}
+	if !vol.ExpiresAt.IsZero() {
+		volumeInfo.Status["expires_at"] = vol.ExpiresAt.UTC().Format(time.RFC3339)
+		volumeInfo.Status["expired"] = vol.expired(d.clock.Now())
+	}
+	return volumeInfo
 }
 
 func (d *LocalDriver) get(logger lager.Logger, volumeName string) (string, error) {
@@ -269,37 +709,49 @@ func (d *LocalDriver) exists(path string) (bool, error) {
 	return true, err
 }
 
-func (d *LocalDriver) mountPath(logger lager.Logger, volumeId string) string {
-	dir, err := d.filepath.Abs(d.mountPathRoot)
-	if err != nil {
-		logger.Fatal("abs-failed", err)
+// mkdirAll is os.MkdirAll with the mode of created directories not masked by the umask.
+func (d *LocalDriver) mkdirAll(path string, mode os.FileMode) error {
+	var created []string
+	for dir := path; dir != d.filepath.Dir(dir); dir = d.filepath.Dir(dir) {
+		if _, err := d.os.Lstat(dir); !os.IsNotExist(err) {
+			break
+		}
+		created = append(created, dir)
 	}
 
-	if !strings.HasSuffix(dir, string(os.PathSeparator)) {
-		dir = fmt.Sprintf("%s%s", dir, string(os.PathSeparator))
+	if err := d.os.MkdirAll(path, mode); err != nil {
+		return err
 	}
+	for _, dir := range created {
+		if err := d.os.Chmod(dir, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	mountsPathRoot := fmt.Sprintf("%s%s", dir, MountsRootDir)
-	orig := d.osHelper.Umask(000)
-	defer d.osHelper.Umask(orig)
-	err = d.os.MkdirAll(mountsPathRoot, os.ModePerm)
+// mountPath is where holder mounts the volume, or where callers without an ID
+// share a mount when holder is empty.
+func (d *LocalDriver) mountPath(logger lager.Logger, root, volumeId, holder string) string {
+	dir, err := d.filepath.Abs(root)
 	if err != nil {
-		logger.Fatal("failed-creating-path", err, lager.Data{"path": mountsPathRoot})
+		logger.Fatal("abs-failed", err)
 	}
 
-	return fmt.Sprintf("%s%s%s", mountsPathRoot, string(os.PathSeparator), volumeId)
+	if holder == "" {
+		holder = SharedMountName
+	}
+	return d.filepath.Join(dir, MountsRootDir, volumeId, holder)
 }
 
-func (d *LocalDriver) volumePath(logger lager.Logger, volumeId string) string {
-	dir, err := d.filepath.Abs(d.mountPathRoot)
+func (d *LocalDriver) volumePath(logger lager.Logger, root, volumeId string) string {
+	dir, err := d.filepath.Abs(root)
 	if err != nil {
 		logger.Fatal("abs-failed", err)
 	}
 
 	volumesPathRoot := d.filepath.Join(dir, VolumesRootDir)
-	orig := d.osHelper.Umask(000)
-	defer d.osHelper.Umask(orig)
-	err = d.os.MkdirAll(volumesPathRoot, os.ModePerm)
+	err = d.mkdirAll(volumesPathRoot, os.ModePerm)
 	if err != nil {
 		logger.Fatal("failed-creating-path", err, lager.Data{"path": volumesPathRoot})
 	}
@@ -318,16 +770,27 @@ func (d *LocalDriver) volumePath(logger lager.Logger, volumeId string) string {
 
 func (d *LocalDriver) mount(logger lager.Logger, volumePath, mountPath string) error {
 	logger.Info("link", lager.Data{"src": volumePath, "tgt": mountPath})
-	orig := d.osHelper.Umask(000)
-	defer d.osHelper.Umask(orig)
+	if err := d.mkdirAll(d.filepath.Dir(mountPath), os.ModePerm); err != nil {
+		return err
+	}
 	return d.os.Symlink(volumePath, mountPath)
 }
 
-func (d *LocalDriver) unmount(logger lager.Logger, name string, mountPath string) dockerdriver.ErrorResponse {
+// unmount releases the mount held by holder, or one of the anonymous mounts
+// if holder does not hold the volume. A holder's mountpoint is removed right
+// away, the shared one once the last anonymous mount is released.
+func (d *LocalDriver) unmount(logger lager.Logger, name string, holder string) dockerdriver.ErrorResponse {
 	logger = logger.Session("unmount")
 	logger.Info("start")
 	defer logger.Info("end")
 
+	vol := d.volumes[name]
+	if !vol.holds(holder) {
+		holder = ""
+	}
+	root := d.volumePool(vol).Path
+	mountPath := d.mountPath(logger, root, name, holder)
+
 	exists, err := d.exists(mountPath)
 	if err != nil {
 		logger.Error("failed-retrieving-mount-info", err, lager.Data{"mountpoint": mountPath})
@@ -340,22 +803,58 @@ func (d *LocalDriver) unmount(logger lager.Logger, name string, mountPath string
 		return dockerdriver.ErrorResponse{Err: errText}
 	}
 
-	d.volumes[name].MountCount--
-	if d.volumes[name].MountCount > 0 {
-		logger.Info("volume-still-in-use", lager.Data{"name": name, "count": d.volumes[name].MountCount})
+	held := vol.Holders[holder]
+	delete(vol.Holders, holder)
+	vol.MountCount--
+	if holder == "" && vol.anonymousMounts() > 0 {
+		logger.Info("volume-still-in-use", lager.Data{"name": name, "count": vol.MountCount})
 		return dockerdriver.ErrorResponse{}
-	} else {
-		logger.Info("unmount-volume-folder", lager.Data{"mountpath": mountPath})
-		err := d.os.Remove(mountPath)
-		if err != nil {
-			logger.Error("unmount-failed", err)
-			return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Error unmounting volume: %s", err.Error())}
+	}
+
+	logger.Info("unmount-volume-folder", lager.Data{"mountpath": mountPath, "holder": holder})
+	err = d.os.Remove(mountPath)
+	if err != nil {
+		logger.Error("unmount-failed", err)
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Error unmounting volume: %s", err.Error())}
+	}
+	if held.Layer != "" {
+		d.removeLayer(logger, d.layerPath(logger, root, name, holder), held.Layer)
+	}
+
+	if vol.MountCount > 0 {
+		logger.Info("volume-still-in-use", lager.Data{"name": name, "count": vol.MountCount})
+		if vol.Mountpoint == mountPath {
+			vol.Mountpoint = d.mountPath(logger, root, name, vol.remainingHolder())
 		}
+		return dockerdriver.ErrorResponse{}
 	}
 
 	logger.Info("unmounted-volume")
+	if err := d.os.Remove(d.filepath.Dir(mountPath)); err != nil {
+		logger.Error("failed-removing-mounts-directory", err)
+	}
+	// a layer still being copied reads from the image
+	if vol.ImageMounted && len(vol.layerCopies) == 0 {
+		// a failure is logged; the image stays mounted until Remove
+		d.detachImage(logger, vol, d.volumePath(logger, root, name))
+	}
 
-	d.volumes[name].Mountpoint = ""
+	vol.Mountpoint = ""
 
 	return dockerdriver.ErrorResponse{}
 }
+
+// unmountAll releases every mount of the volume.
+func (d *LocalDriver) unmountAll(logger lager.Logger, vol *LocalVolumeInfo) dockerdriver.ErrorResponse {
+	for _, holder := range vol.holderIDs() {
+		if response := d.unmount(logger, vol.Name, holder); response.Err != "" {
+			return response
+		}
+	}
+	for vol.anonymousMounts() > 0 {
+		if response := d.unmount(logger, vol.Name, ""); response.Err != "" {
+			return response
+		}
+	}
+	return dockerdriver.ErrorResponse{}
+}
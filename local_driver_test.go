@@ -6,11 +6,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
 
+	"code.cloudfoundry.org/clock/fakeclock"
 	"code.cloudfoundry.org/dockerdriver"
 	"code.cloudfoundry.org/dockerdriver/driverhttp"
 	dockerdriverutils "code.cloudfoundry.org/dockerdriver/utils"
 	"code.cloudfoundry.org/goshims/filepathshim"
+	"code.cloudfoundry.org/goshims/osshim"
 	"code.cloudfoundry.org/goshims/osshim/os_fake"
 	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/lager/v3/lagertest"
@@ -50,7 +55,7 @@ var _ = Describe("Local Driver", func() {
 		uniqueVolumeIds = false
 
 		expectedVolume = filepath.Join(mountDir, "_volumes", "test-volume-id")
-		expectedMounts = filepath.Join(mountDir, "_mounts", "test-volume-id")
+		expectedMounts = filepath.Join(mountDir, "_mounts", "test-volume-id", localdriver.SharedMountName)
 
 		testOs = &os_fake.FakeOs{}
 		testFilepath = &filepathshim.FilepathShim{}
@@ -319,6 +324,1856 @@ var _ = Describe("Local Driver", func() {
 				})
 			})
 		})
+
+		Context("when many volumes are created in parallel", func() {
+			var originalUmask int
+
+			BeforeEach(func() {
+				// a restrictive umask must not leak into the modes asked for
+				originalUmask = syscall.Umask(077)
+			})
+
+			AfterEach(func() {
+				syscall.Umask(originalUmask)
+			})
+
+			JustBeforeEach(func() {
+				localDriver, err = localdriver.NewLocalDriverWithConfig(state, &osshim.OsShim{}, testFilepath, oshelper.NewOsHelper(), localdriver.Config{
+					Pools: []localdriver.Pool{{Name: localdriver.DefaultPoolName, Path: mountDir}},
+				})
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("gives every volume root the mode it asked for", func() {
+				modes := []string{"0700", "0750", "0755", "0777"}
+
+				var wg sync.WaitGroup
+				for i := 0; i < 40; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer GinkgoRecover()
+						defer wg.Done()
+						createResponse := localDriver.Create(env, dockerdriver.CreateRequest{
+							Name: fmt.Sprintf("volume-%d", i),
+							Opts: map[string]interface{}{"mode": modes[i%len(modes)]},
+						})
+						Expect(createResponse.Err).To(Equal(""))
+					}(i)
+				}
+				wg.Wait()
+
+				for i := 0; i < 40; i++ {
+					info, err := os.Stat(filepath.Join(mountDir, "_volumes", fmt.Sprintf("volume-%d", i)))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fmt.Sprintf("%04o", info.Mode().Perm())).To(Equal(modes[i%len(modes)]))
+				}
+
+				info, err := os.Stat(filepath.Join(mountDir, "_volumes"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Mode().Perm()).To(Equal(os.ModePerm))
+				Expect(syscall.Umask(077)).To(Equal(077))
+			})
+
+			It("makes the mounts directories traversable", func() {
+				createSuccessful(env, localDriver, volumeId)
+				mountSuccessful(env, localDriver, volumeId)
+
+				for _, dir := range []string{filepath.Join(mountDir, "_mounts"), filepath.Join(mountDir, "_mounts", volumeId)} {
+					info, err := os.Stat(dir)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.Mode().Perm()).To(Equal(os.ModePerm))
+				}
+			})
+		})
+
+		Context("with ownership options", func() {
+			createWithOpts := func(opts map[string]interface{}) dockerdriver.ErrorResponse {
+				return localDriver.Create(env, dockerdriver.CreateRequest{Name: volumeId, Opts: opts})
+			}
+
+			It("applies the uid, gid and mode to the volume root", func() {
+				Expect(createWithOpts(map[string]interface{}{"uid": float64(1000), "gid": "1001", "mode": "0750"}).Err).To(Equal(""))
+
+				Expect(testOs.ChownCallCount()).To(Equal(1))
+				path, uid, gid := testOs.ChownArgsForCall(0)
+				Expect(path).To(Equal(expectedVolume))
+				Expect(uid).To(Equal(1000))
+				Expect(gid).To(Equal(1001))
+				path, mode := testOs.ChmodArgsForCall(testOs.ChmodCallCount() - 1)
+				Expect(path).To(Equal(expectedVolume))
+				Expect(mode).To(Equal(os.FileMode(0750)))
+
+				getResponse := getSuccessful(env, localDriver, volumeId)
+				Expect(getResponse.Volume.Status).To(HaveKeyWithValue("uid", 1000))
+				Expect(getResponse.Volume.Status).To(HaveKeyWithValue("gid", 1001))
+				Expect(getResponse.Volume.Status).To(HaveKeyWithValue("mode", "0750"))
+			})
+
+			It("keeps the driver as owner and makes the root writable by it only by default", func() {
+				testOs.GetuidReturns(42)
+				testOs.GetgidReturns(43)
+				createSuccessful(env, localDriver, volumeId)
+
+				Expect(testOs.ChownCallCount()).To(BeZero())
+				_, mode := testOs.ChmodArgsForCall(testOs.ChmodCallCount() - 1)
+				Expect(mode).To(Equal(localdriver.DefaultVolumeMode))
+
+				getResponse := getSuccessful(env, localDriver, volumeId)
+				Expect(getResponse.Volume.Status).To(HaveKeyWithValue("uid", 42))
+				Expect(getResponse.Volume.Status).To(HaveKeyWithValue("gid", 43))
+				Expect(getResponse.Volume.Status).To(HaveKeyWithValue("mode", "0755"))
+			})
+
+			It("changes only the group when only a gid is given", func() {
+				Expect(createWithOpts(map[string]interface{}{"gid": float64(1001)}).Err).To(Equal(""))
+				_, uid, gid := testOs.ChownArgsForCall(0)
+				Expect(uid).To(Equal(-1))
+				Expect(gid).To(Equal(1001))
+			})
+
+			DescribeTable("refuses invalid options",
+				func(opts map[string]interface{}, message string) {
+					Expect(createWithOpts(opts).Err).To(ContainSubstring(message))
+					getUnsuccessful(env, localDriver, volumeId)
+				},
+				Entry("negative uid", map[string]interface{}{"uid": float64(-1)}, "Invalid 'uid' option"),
+				Entry("fractional gid", map[string]interface{}{"gid": 1.5}, "Invalid 'gid' option"),
+				Entry("non-numeric uid", map[string]interface{}{"uid": "root"}, "Invalid 'uid' option"),
+				Entry("numeric mode", map[string]interface{}{"mode": float64(750)}, "Invalid 'mode' option"),
+				Entry("non-octal mode", map[string]interface{}{"mode": "0980"}, "Invalid 'mode' option"),
+				Entry("mode with extra bits", map[string]interface{}{"mode": "4755"}, "Invalid 'mode' option"),
+				Entry("no permissions at all", map[string]interface{}{"mode": "0000"}, "Invalid 'mode' option: 0000 leaves the volume inaccessible"),
+			)
+
+			Context("when the owner cannot be changed", func() {
+				BeforeEach(func() {
+					testOs.ChownReturns(errors.New("operation not permitted"))
+				})
+
+				It("fails and leaves no volume behind", func() {
+					Expect(createWithOpts(map[string]interface{}{"uid": float64(1000)}).Err).To(Equal("Failed setting ownership of volume: operation not permitted"))
+					Expect(testOs.RemoveAllArgsForCall(0)).To(Equal(expectedVolume))
+					getUnsuccessful(env, localDriver, volumeId)
+				})
+			})
+		})
+	})
+
+	Describe("Pools", func() {
+		var (
+			fastDir   string
+			slowDir   string
+			pools     []localdriver.Pool
+			placement localdriver.PlacementPolicy
+			fakeClock *fakeclock.FakeClock
+		)
+
+		BeforeEach(func() {
+			fakeClock = fakeclock.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+			fastDir = filepath.Join(mountDir, "fast")
+			slowDir = filepath.Join(mountDir, "slow")
+			pools = []localdriver.Pool{
+				{Name: localdriver.DefaultPoolName, Path: mountDir},
+				{Name: "fast", Path: fastDir},
+				{Name: "slow", Path: slowDir},
+			}
+			placement = localdriver.PlacementFirst
+		})
+
+		JustBeforeEach(func() {
+			localDriver, err = localdriver.NewLocalDriverWithConfig(state, testOs, testFilepath, oshelper.NewOsHelper(), localdriver.Config{
+				Pools:     pools,
+				Placement: placement,
+				Clock:     fakeClock,
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("creates the volume in the pool named by the 'pool' option", func() {
+			createResponse := localDriver.Create(env, dockerdriver.CreateRequest{
+				Name: volumeId,
+				Opts: map[string]interface{}{"pool": "fast"},
+			})
+			Expect(createResponse.Err).To(Equal(""))
+
+			created, _ := testOs.MkdirAllArgsForCall(testOs.MkdirAllCallCount() - 1)
+			Expect(created).To(Equal(filepath.Join(fastDir, "_volumes", volumeId)))
+
+			getResponse := getSuccessful(env, localDriver, volumeId)
+			Expect(getResponse.Volume.Status).To(HaveKeyWithValue("pool", "fast"))
+		})
+
+		It("mounts the volume from its pool", func() {
+			createResponse := localDriver.Create(env, dockerdriver.CreateRequest{
+				Name: volumeId,
+				Opts: map[string]interface{}{"pool": "slow"},
+			})
+			Expect(createResponse.Err).To(Equal(""))
+			mountSuccessful(env, localDriver, volumeId)
+
+			src, tgt := testOs.SymlinkArgsForCall(0)
+			Expect(src).To(Equal(filepath.Join(slowDir, "_volumes", volumeId)))
+			Expect(tgt).To(Equal(filepath.Join(slowDir, "_mounts", volumeId, localdriver.SharedMountName)))
+		})
+
+		It("reports the pool in List", func() {
+			createSuccessful(env, localDriver, volumeId)
+
+			listResponse := localDriver.List(env)
+			Expect(listResponse.Volumes).To(HaveLen(1))
+			Expect(listResponse.Volumes[0].Status).To(HaveKeyWithValue("pool", localdriver.DefaultPoolName))
+		})
+
+		It("fails when the requested pool does not exist", func() {
+			createResponse := localDriver.Create(env, dockerdriver.CreateRequest{
+				Name: volumeId,
+				Opts: map[string]interface{}{"pool": "missing"},
+			})
+			Expect(createResponse.Err).To(Equal("Pool 'missing' not found"))
+			getUnsuccessful(env, localDriver, volumeId)
+		})
+
+		Context("when the placement policy is round-robin", func() {
+			BeforeEach(func() {
+				placement = localdriver.PlacementRoundRobin
+			})
+
+			It("spreads volumes across the pools", func() {
+				for _, name := range []string{"vol-1", "vol-2", "vol-3", "vol-4"} {
+					createSuccessful(env, localDriver, name)
+				}
+
+				Expect(getSuccessful(env, localDriver, "vol-1").Volume.Status).To(HaveKeyWithValue("pool", localdriver.DefaultPoolName))
+				Expect(getSuccessful(env, localDriver, "vol-2").Volume.Status).To(HaveKeyWithValue("pool", "fast"))
+				Expect(getSuccessful(env, localDriver, "vol-3").Volume.Status).To(HaveKeyWithValue("pool", "slow"))
+				Expect(getSuccessful(env, localDriver, "vol-4").Volume.Status).To(HaveKeyWithValue("pool", localdriver.DefaultPoolName))
+			})
+		})
+
+		DescribeTable("refuses an invalid configuration",
+			func(config localdriver.Config, message string) {
+				_, err := localdriver.NewLocalDriverWithConfig(state, testOs, testFilepath, oshelper.NewOsHelper(), config)
+				Expect(err).To(MatchError(message))
+			},
+			Entry("no pools", localdriver.Config{}, "no pools configured"),
+			Entry("a pool without a name", localdriver.Config{Pools: []localdriver.Pool{{Path: "/pool"}}}, "pool at '/pool' has no name"),
+			Entry("two pools with the same name", localdriver.Config{Pools: []localdriver.Pool{{Name: "a", Path: "/a"}, {Name: "a", Path: "/b"}}}, "duplicate pool name 'a'"),
+			Entry("an unknown placement policy", localdriver.Config{Pools: []localdriver.Pool{{Name: "a", Path: "/a"}}, Placement: "random"}, "invalid placement policy 'random'"),
+		)
+
+		Context("when a pool has reached its capacity", func() {
+			BeforeEach(func() {
+				pools[1].Capacity = 10
+			})
+
+			JustBeforeEach(func() {
+				createResponse := localDriver.Create(env, dockerdriver.CreateRequest{
+					Name: "existing",
+					Opts: map[string]interface{}{"pool": "fast"},
+				})
+				Expect(createResponse.Err).To(Equal(""))
+
+				Expect(os.MkdirAll(filepath.Join(fastDir, "_volumes", "existing"), os.ModePerm)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(fastDir, "_volumes", "existing", "data"), make([]byte, 20), 0600)).To(Succeed())
+				fakeClock.Increment(localdriver.PoolUsageMaxAge)
+			})
+
+			It("refuses to create more volumes in that pool", func() {
+				createResponse := localDriver.Create(env, dockerdriver.CreateRequest{
+					Name: volumeId,
+					Opts: map[string]interface{}{"pool": "fast"},
+				})
+				Expect(createResponse.Err).To(Equal("Pool 'fast' is full"))
+			})
+
+			It("measures the pool again only once the last measurement is old", func() {
+				createResponse := localDriver.Create(env, dockerdriver.CreateRequest{
+					Name: volumeId,
+					Opts: map[string]interface{}{"pool": "fast"},
+				})
+				Expect(createResponse.Err).To(Equal("Pool 'fast' is full"))
+
+				Expect(os.Remove(filepath.Join(fastDir, "_volumes", "existing", "data"))).To(Succeed())
+				createResponse = localDriver.Create(env, dockerdriver.CreateRequest{
+					Name: volumeId,
+					Opts: map[string]interface{}{"pool": "fast"},
+				})
+				Expect(createResponse.Err).To(Equal("Pool 'fast' is full"))
+
+				fakeClock.Increment(localdriver.PoolUsageMaxAge)
+				createResponse = localDriver.Create(env, dockerdriver.CreateRequest{
+					Name: volumeId,
+					Opts: map[string]interface{}{"pool": "fast"},
+				})
+				Expect(createResponse.Err).To(Equal(""))
+			})
+
+			Context("and the files in it are sparse", func() {
+				BeforeEach(func() {
+					pools[1].Capacity = 1024 * 1024
+				})
+
+				It("counts only the space allocated to them", func() {
+					Expect(os.Truncate(filepath.Join(fastDir, "_volumes", "existing", "data"), 1024*1024*1024)).To(Succeed())
+					fakeClock.Increment(localdriver.PoolUsageMaxAge)
+
+					createResponse := localDriver.Create(env, dockerdriver.CreateRequest{
+						Name: volumeId,
+						Opts: map[string]interface{}{"pool": "fast"},
+					})
+					Expect(createResponse.Err).To(Equal(""))
+				})
+			})
+
+			Context("and the placement policy is most-free-space", func() {
+				BeforeEach(func() {
+					placement = localdriver.PlacementMostFreeSpace
+					pools = pools[1:2]
+					pools = append(pools, localdriver.Pool{Name: "other", Path: slowDir, Capacity: 1000})
+				})
+
+				It("places the volume in a pool with room", func() {
+					createSuccessful(env, localDriver, volumeId)
+					getResponse := getSuccessful(env, localDriver, volumeId)
+					Expect(getResponse.Volume.Status).To(HaveKeyWithValue("pool", "other"))
+				})
+			})
+		})
+	})
+
+	Describe("Free space thresholds", func() {
+		var (
+			osHelper *capacityOsHelper
+			fullDir  string
+			roomyDir string
+			config   localdriver.Config
+		)
+
+		BeforeEach(func() {
+			fullDir = filepath.Join(mountDir, "full")
+			roomyDir = filepath.Join(mountDir, "roomy")
+			Expect(os.MkdirAll(fullDir, os.ModePerm)).To(Succeed())
+			Expect(os.MkdirAll(roomyDir, os.ModePerm)).To(Succeed())
+
+			osHelper = &capacityOsHelper{OsHelper: oshelper.NewOsHelper(), stats: map[string]localdriver.FilesystemStats{
+				fullDir:  {TotalBytes: 10 * 1024 * 1024 * 1024, FreeBytes: 512 * 1024 * 1024, TotalInodes: 1000, FreeInodes: 900},
+				roomyDir: {TotalBytes: 10 * 1024 * 1024 * 1024, FreeBytes: 8 * 1024 * 1024 * 1024, TotalInodes: 1000, FreeInodes: 50},
+			}}
+			config = localdriver.Config{
+				Pools:        []localdriver.Pool{{Name: "full", Path: fullDir}, {Name: "roomy", Path: roomyDir}},
+				MinFreeBytes: 1024 * 1024 * 1024,
+			}
+		})
+
+		JustBeforeEach(func() {
+			localDriver, err = localdriver.NewLocalDriverWithConfig(state, &osshim.OsShim{}, testFilepath, osHelper, config)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		createInPool := func(pool string) dockerdriver.ErrorResponse {
+			return localDriver.Create(env, dockerdriver.CreateRequest{Name: volumeId, Opts: map[string]interface{}{"pool": pool}})
+		}
+
+		It("refuses a pool with less free space than the minimum", func() {
+			Expect(createInPool("full").Err).To(Equal("Pool 'full' has 512M free, less than the minimum of 1G"))
+			getUnsuccessful(env, localDriver, volumeId)
+			Expect(filepath.Join(fullDir, "_volumes", volumeId)).NotTo(BeADirectory())
+		})
+
+		It("places volumes without a pool in a pool with room", func() {
+			createSuccessful(env, localDriver, volumeId)
+			Expect(getSuccessful(env, localDriver, volumeId).Volume.Status).To(HaveKeyWithValue("pool", "roomy"))
+		})
+
+		It("runs statfs once per pool when listing volumes", func() {
+			for _, name := range []string{"vol-a", "vol-b", "vol-c"} {
+				createSuccessful(env, localDriver, name)
+			}
+			osHelper.statfs = nil
+
+			Expect(localDriver.List(env).Volumes).To(HaveLen(3))
+			Expect(osHelper.statfs).To(Equal(map[string]int{roomyDir: 1}))
+		})
+
+		Context("when statfs does not find a pool directory", func() {
+			BeforeEach(func() {
+				newDir := filepath.Join(mountDir, "new")
+				osHelper.errs = map[string]error{newDir: os.ErrNotExist}
+				osHelper.stats[mountDir] = localdriver.FilesystemStats{TotalBytes: 1024, FreeBytes: 4}
+				config.Pools = append(config.Pools, localdriver.Pool{Name: "new", Path: newDir})
+			})
+
+			It("counts the free space of the filesystem above it", func() {
+				Expect(createInPool("roomy").Err).To(Equal(""))
+				Expect(os.WriteFile(filepath.Join(roomyDir, "_volumes", volumeId, "data"), []byte("some-data"), 0644)).To(Succeed())
+
+				moveResponse := localDriver.Move(env, localdriver.MoveRequest{Name: volumeId, Pool: "new"})
+				Expect(moveResponse.Err).To(Equal("Pool 'new' does not have room for volume 'test-volume-id'"))
+			})
+		})
+
+		Context("when there are too few free inodes", func() {
+			BeforeEach(func() {
+				config.MinFreeBytes = 0
+				config.MinFreeInodes = 100
+			})
+
+			It("refuses the pool", func() {
+				Expect(createInPool("roomy").Err).To(Equal("Pool 'roomy' has 50 free inodes, less than the minimum of 100"))
+				Expect(createInPool("full").Err).To(Equal(""))
+			})
+		})
+
+		Context("when no pool has room", func() {
+			BeforeEach(func() {
+				config.MinFreeBytes = 16 * 1024 * 1024 * 1024
+			})
+
+			It("names the threshold that was missed", func() {
+				createResponse := localDriver.Create(env, dockerdriver.CreateRequest{Name: volumeId})
+				Expect(createResponse.Err).To(Equal("Pool 'full' has 512M free, less than the minimum of 16G"))
+			})
+		})
+
+		It("reports the capacity of the volume's pool in Get and List", func() {
+			Expect(createInPool("roomy").Err).To(Equal(""))
+
+			expected := localdriver.PoolCapacity{Name: "roomy", TotalBytes: 10 * 1024 * 1024 * 1024, FreeBytes: 8 * 1024 * 1024 * 1024, TotalInodes: 1000, FreeInodes: 50}
+			Expect(getSuccessful(env, localDriver, volumeId).Volume.Status).To(HaveKeyWithValue("pool_capacity", expected))
+			Expect(localDriver.List(env).Volumes[0].Status).To(HaveKeyWithValue("pool_capacity", expected))
+		})
+
+		It("reports the capacity of every pool", func() {
+			capacities := localDriver.PoolCapacities(env)
+			Expect(capacities).To(HaveLen(2))
+			Expect(capacities[0]).To(Equal(localdriver.PoolCapacity{Name: "full", TotalBytes: 10 * 1024 * 1024 * 1024, FreeBytes: 512 * 1024 * 1024, TotalInodes: 1000, FreeInodes: 900, BelowMinimum: true}))
+			Expect(capacities[1].BelowMinimum).To(BeFalse())
+		})
+
+		It("measures a pool that has not been created yet on its parent", func() {
+			osHelper.stats[mountDir] = localdriver.FilesystemStats{TotalBytes: 100, FreeBytes: 10}
+			config.Pools = append(config.Pools, localdriver.Pool{Name: "new", Path: filepath.Join(mountDir, "new", "pool")})
+			localDriver, err = localdriver.NewLocalDriverWithConfig(state, &osshim.OsShim{}, testFilepath, osHelper, config)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(localDriver.PoolCapacities(env)[2]).To(Equal(localdriver.PoolCapacity{Name: "new", TotalBytes: 100, FreeBytes: 10, BelowMinimum: true}))
+		})
+	})
+
+	Describe("Move", func() {
+		var (
+			otherDir     string
+			sourceVolume string
+			targetVolume string
+			driverOs     osshim.Os
+		)
+
+		BeforeEach(func() {
+			otherDir = filepath.Join(mountDir, "other")
+			sourceVolume = filepath.Join(mountDir, "_volumes", volumeId)
+			targetVolume = filepath.Join(otherDir, "_volumes", volumeId)
+			driverOs = &osshim.OsShim{}
+		})
+
+		JustBeforeEach(func() {
+			localDriver, err = localdriver.NewLocalDriverWithConfig(state, driverOs, testFilepath, oshelper.NewOsHelper(), localdriver.Config{
+				Pools: []localdriver.Pool{
+					{Name: localdriver.DefaultPoolName, Path: mountDir},
+					{Name: "other", Path: otherDir},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			createSuccessful(env, localDriver, volumeId)
+
+			Expect(os.MkdirAll(filepath.Join(sourceVolume, "nested"), 0750)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(sourceVolume, "nested", "data"), []byte("some-data"), 0640)).To(Succeed())
+			Expect(os.Symlink("nested/data", filepath.Join(sourceVolume, "link"))).To(Succeed())
+		})
+
+		It("copies the data to the new pool and removes the source", func() {
+			moveResponse := localDriver.Move(env, localdriver.MoveRequest{Name: volumeId, Pool: "other"})
+			Expect(moveResponse.Err).To(Equal(""))
+
+			contents, err := os.ReadFile(filepath.Join(targetVolume, "nested", "data"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("some-data"))
+
+			link, err := os.Readlink(filepath.Join(targetVolume, "link"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(link).To(Equal("nested/data"))
+
+			info, err := os.Stat(filepath.Join(targetVolume, "nested"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0750)))
+
+			Expect(sourceVolume).NotTo(BeADirectory())
+
+			getResponse := getSuccessful(env, localDriver, volumeId)
+			Expect(getResponse.Volume.Status).To(HaveKeyWithValue("pool", "other"))
+		})
+
+		It("mounts the volume from the new pool afterwards", func() {
+			moveResponse := localDriver.Move(env, localdriver.MoveRequest{Name: volumeId, Pool: "other"})
+			Expect(moveResponse.Err).To(Equal(""))
+
+			mountSuccessful(env, localDriver, volumeId)
+			contents, err := os.ReadFile(filepath.Join(otherDir, "_mounts", volumeId, localdriver.SharedMountName, "nested", "data"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("some-data"))
+			unmountSuccessful(env, localDriver, volumeId)
+		})
+
+		It("keeps the owner and mode of every entry", func() {
+			if os.Getuid() != 0 {
+				Skip("changing the owner of files requires root")
+			}
+			nested := filepath.Join(sourceVolume, "nested")
+			Expect(os.Chown(nested, 1000, 1001)).To(Succeed())
+			Expect(os.Chmod(nested, 0550|os.ModeSetgid)).To(Succeed())
+			Expect(os.Chown(filepath.Join(nested, "data"), 1002, 1003)).To(Succeed())
+			Expect(os.Lchown(filepath.Join(sourceVolume, "link"), 1004, 1005)).To(Succeed())
+			Expect(os.Chmod(sourceVolume, 0777|os.ModeSticky)).To(Succeed())
+
+			moveResponse := localDriver.Move(env, localdriver.MoveRequest{Name: volumeId, Pool: "other"})
+			Expect(moveResponse.Err).To(Equal(""))
+
+			owner := func(path string) (uint32, uint32, os.FileMode) {
+				info, err := os.Lstat(path)
+				Expect(err).NotTo(HaveOccurred())
+				stat := info.Sys().(*syscall.Stat_t)
+				return stat.Uid, stat.Gid, info.Mode()
+			}
+
+			uid, gid, mode := owner(filepath.Join(targetVolume, "nested"))
+			Expect([]interface{}{uid, gid, mode}).To(Equal([]interface{}{uint32(1000), uint32(1001), os.ModeDir | os.ModeSetgid | 0550}))
+			uid, gid, mode = owner(filepath.Join(targetVolume, "nested", "data"))
+			Expect([]interface{}{uid, gid, mode}).To(Equal([]interface{}{uint32(1002), uint32(1003), os.FileMode(0640)}))
+			uid, gid, _ = owner(filepath.Join(targetVolume, "link"))
+			Expect([]interface{}{uid, gid}).To(Equal([]interface{}{uint32(1004), uint32(1005)}))
+			_, _, mode = owner(targetVolume)
+			Expect(mode).To(Equal(os.ModeDir | os.ModeSticky | 0777))
+		})
+
+		It("keeps sparse files sparse", func() {
+			image, err := os.Create(filepath.Join(sourceVolume, "image"))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = image.WriteAt([]byte("superblock"), 16*1024*1024)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(image.Truncate(64 * 1024 * 1024)).To(Succeed())
+			Expect(image.Close()).To(Succeed())
+
+			moveResponse := localDriver.Move(env, localdriver.MoveRequest{Name: volumeId, Pool: "other"})
+			Expect(moveResponse.Err).To(Equal(""))
+
+			info, err := os.Stat(filepath.Join(targetVolume, "image"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Size()).To(Equal(int64(64 * 1024 * 1024)))
+			Expect(info.Sys().(*syscall.Stat_t).Blocks * 512).To(BeNumerically("<", 1024*1024))
+
+			contents, err := os.ReadFile(filepath.Join(targetVolume, "image"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents[16*1024*1024 : 16*1024*1024+10])).To(Equal("superblock"))
+		})
+
+		Context("while the volume is being copied", func() {
+			var copying *blockingOs
+
+			BeforeEach(func() {
+				copying = &blockingOs{started: make(chan struct{}), release: make(chan struct{})}
+				driverOs = copying
+			})
+
+			It("keeps serving other calls and refuses to use the volume", func() {
+				moved := make(chan dockerdriver.ErrorResponse)
+				go func() {
+					moved <- localDriver.Move(env, localdriver.MoveRequest{Name: volumeId, Pool: "other"})
+				}()
+				Eventually(copying.started).Should(BeClosed())
+
+				listed := make(chan dockerdriver.ListResponse)
+				go func() {
+					listed <- localDriver.List(env)
+				}()
+				Eventually(listed).Should(Receive())
+
+				mountResponse := localDriver.Mount(env, dockerdriver.MountRequest{Name: volumeId})
+				Expect(mountResponse.Err).To(Equal("Volume 'test-volume-id' is being moved"))
+				removeResponse := localDriver.Remove(env, dockerdriver.RemoveRequest{Name: volumeId})
+				Expect(removeResponse.Err).To(Equal("Volume 'test-volume-id' is being moved"))
+				moveResponse := localDriver.Move(env, localdriver.MoveRequest{Name: volumeId, Pool: "other"})
+				Expect(moveResponse.Err).To(Equal("Volume 'test-volume-id' is being moved"))
+
+				close(copying.release)
+				Eventually(moved).Should(Receive(Equal(dockerdriver.ErrorResponse{})))
+				Expect(getSuccessful(env, localDriver, volumeId).Volume.Status).To(HaveKeyWithValue("pool", "other"))
+				mountSuccessful(env, localDriver, volumeId)
+				unmountSuccessful(env, localDriver, volumeId)
+			})
+		})
+
+		It("refuses to move a mounted volume", func() {
+			mountSuccessful(env, localDriver, volumeId)
+
+			moveResponse := localDriver.Move(env, localdriver.MoveRequest{Name: volumeId, Pool: "other"})
+			Expect(moveResponse.Err).To(Equal("Volume 'test-volume-id' is mounted and cannot be moved"))
+			Expect(sourceVolume).To(BeADirectory())
+
+			unmountSuccessful(env, localDriver, volumeId)
+		})
+
+		It("refuses to move to an unknown pool", func() {
+			moveResponse := localDriver.Move(env, localdriver.MoveRequest{Name: volumeId, Pool: "missing"})
+			Expect(moveResponse.Err).To(Equal("Pool 'missing' not found"))
+		})
+
+		It("refuses to move a volume into the pool it is already in", func() {
+			moveResponse := localDriver.Move(env, localdriver.MoveRequest{Name: volumeId, Pool: localdriver.DefaultPoolName})
+			Expect(moveResponse.Err).To(Equal("Volume 'test-volume-id' is already in pool 'default'"))
+		})
+
+		Context("when the target already holds a directory for the volume", func() {
+			JustBeforeEach(func() {
+				Expect(os.MkdirAll(targetVolume, os.ModePerm)).To(Succeed())
+			})
+
+			It("leaves the volume in place", func() {
+				moveResponse := localDriver.Move(env, localdriver.MoveRequest{Name: volumeId, Pool: "other"})
+				Expect(moveResponse.Err).To(ContainSubstring("already exists in pool 'other'"))
+				Expect(sourceVolume).To(BeADirectory())
+
+				getResponse := getSuccessful(env, localDriver, volumeId)
+				Expect(getResponse.Volume.Status).To(HaveKeyWithValue("pool", localdriver.DefaultPoolName))
+			})
+		})
+	})
+
+	Describe("Labels", func() {
+		createWithLabels := func(name string, labels map[string]interface{}) dockerdriver.ErrorResponse {
+			return localDriver.Create(env, dockerdriver.CreateRequest{
+				Name: name,
+				Opts: map[string]interface{}{"labels": labels},
+			})
+		}
+
+		It("returns the labels in Get and List", func() {
+			Expect(createWithLabels(volumeId, map[string]interface{}{"suite": "smoke", "run": "42"}).Err).To(Equal(""))
+
+			getResponse := getSuccessful(env, localDriver, volumeId)
+			Expect(getResponse.Volume.Status).To(HaveKeyWithValue("labels", map[string]string{"suite": "smoke", "run": "42"}))
+
+			listResponse := localDriver.List(env)
+			Expect(listResponse.Volumes[0].Status).To(HaveKeyWithValue("labels", map[string]string{"suite": "smoke", "run": "42"}))
+		})
+
+		It("rejects labels that are not strings", func() {
+			createResponse := createWithLabels(volumeId, map[string]interface{}{"run": 42})
+			Expect(createResponse.Err).To(Equal("Invalid 'labels' option: value of label 'run' is not a string"))
+			getUnsuccessful(env, localDriver, volumeId)
+		})
+
+		It("filters ListVolumes by label", func() {
+			Expect(createWithLabels("vol-a", map[string]interface{}{"suite": "smoke", "run": "1"}).Err).To(Equal(""))
+			Expect(createWithLabels("vol-b", map[string]interface{}{"suite": "smoke", "run": "2"}).Err).To(Equal(""))
+			Expect(createWithLabels("vol-c", map[string]interface{}{"suite": "acceptance", "run": "1"}).Err).To(Equal(""))
+			createSuccessful(env, localDriver, "vol-d")
+
+			names := func(listResponse dockerdriver.ListResponse) []string {
+				var result []string
+				for _, volume := range listResponse.Volumes {
+					result = append(result, volume.Name)
+				}
+				return result
+			}
+
+			Expect(names(localDriver.ListVolumes(env, localdriver.ListVolumesRequest{}))).To(Equal([]string{"vol-a", "vol-b", "vol-c", "vol-d"}))
+			Expect(names(localDriver.ListVolumes(env, localdriver.ListVolumesRequest{Labels: map[string]string{"suite": "smoke"}}))).To(Equal([]string{"vol-a", "vol-b"}))
+			Expect(names(localDriver.ListVolumes(env, localdriver.ListVolumesRequest{Labels: map[string]string{"suite": "smoke", "run": "1"}}))).To(Equal([]string{"vol-a"}))
+			Expect(localDriver.ListVolumes(env, localdriver.ListVolumesRequest{Labels: map[string]string{"suite": "other"}}).Volumes).To(BeEmpty())
+		})
+	})
+
+	Describe("Expiry", func() {
+		var fakeClock *fakeclock.FakeClock
+
+		BeforeEach(func() {
+			fakeClock = fakeclock.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		})
+
+		JustBeforeEach(func() {
+			localDriver, err = localdriver.NewLocalDriverWithConfig(state, testOs, testFilepath, oshelper.NewOsHelper(), localdriver.Config{
+				Pools: []localdriver.Pool{{Name: localdriver.DefaultPoolName, Path: mountDir}},
+				Clock: fakeClock,
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		createWithTTL := func(name string, ttl interface{}) dockerdriver.ErrorResponse {
+			return localDriver.Create(env, dockerdriver.CreateRequest{
+				Name: name,
+				Opts: map[string]interface{}{"ttl": ttl},
+			})
+		}
+
+		It("reports the expiry time in Get", func() {
+			Expect(createWithTTL(volumeId, "1h").Err).To(Equal(""))
+
+			getResponse := getSuccessful(env, localDriver, volumeId)
+			Expect(getResponse.Volume.Status).To(HaveKeyWithValue("expires_at", "2020-01-01T01:00:00Z"))
+			Expect(getResponse.Volume.Status).To(HaveKeyWithValue("expired", false))
+		})
+
+		It("accepts the ttl as a number of seconds", func() {
+			Expect(createWithTTL(volumeId, float64(90)).Err).To(Equal(""))
+
+			getResponse := getSuccessful(env, localDriver, volumeId)
+			Expect(getResponse.Volume.Status).To(HaveKeyWithValue("expires_at", "2020-01-01T00:01:30Z"))
+		})
+
+		It("rejects an invalid ttl", func() {
+			Expect(createWithTTL(volumeId, "soon").Err).To(ContainSubstring("Invalid 'ttl' option"))
+			Expect(createWithTTL(volumeId, "-1h").Err).To(Equal("Invalid 'ttl' option: must be positive"))
+			getUnsuccessful(env, localDriver, volumeId)
+		})
+
+		Describe("ReapExpired", func() {
+			JustBeforeEach(func() {
+				Expect(createWithTTL("short-lived", "1m").Err).To(Equal(""))
+				Expect(createWithTTL("mounted", "1m").Err).To(Equal(""))
+				Expect(createWithTTL("long-lived", "1h").Err).To(Equal(""))
+				createSuccessful(env, localDriver, "forever")
+				mountSuccessful(env, localDriver, "mounted")
+			})
+
+			It("does nothing before the ttl has passed", func() {
+				reapResponse := localDriver.ReapExpired(env)
+				Expect(reapResponse.Removed).To(BeEmpty())
+				Expect(reapResponse.Mounted).To(BeEmpty())
+			})
+
+			It("removes expired volumes and reports the mounted ones", func() {
+				fakeClock.Increment(2 * time.Minute)
+
+				reapResponse := localDriver.ReapExpired(env)
+				Expect(reapResponse.Err).To(Equal(""))
+				Expect(reapResponse.Removed).To(Equal([]string{"short-lived"}))
+				Expect(reapResponse.Mounted).To(Equal([]string{"mounted"}))
+
+				getUnsuccessful(env, localDriver, "short-lived")
+				Expect(testOs.RemoveAllArgsForCall(0)).To(Equal(filepath.Join(mountDir, "_volumes", "short-lived")))
+
+				getResponse := getSuccessful(env, localDriver, "mounted")
+				Expect(getResponse.Volume.Status).To(HaveKeyWithValue("expired", true))
+				getSuccessful(env, localDriver, "long-lived")
+				getSuccessful(env, localDriver, "forever")
+			})
+
+			It("removes an expired volume once it is unmounted", func() {
+				fakeClock.Increment(2 * time.Minute)
+				unmountSuccessful(env, localDriver, "mounted")
+
+				reapResponse := localDriver.ReapExpired(env)
+				Expect(reapResponse.Removed).To(Equal([]string{"mounted", "short-lived"}))
+			})
+		})
+	})
+
+	Describe("Trash", func() {
+		var (
+			fakeClock *fakeclock.FakeClock
+			trashId   string
+		)
+
+		BeforeEach(func() {
+			fakeClock = fakeclock.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+			trashId = "test-volume-id.20200101T000000.000000000Z"
+		})
+
+		JustBeforeEach(func() {
+			localDriver, err = localdriver.NewLocalDriverWithConfig(state, &osshim.OsShim{}, testFilepath, oshelper.NewOsHelper(), localdriver.Config{
+				Pools:          []localdriver.Pool{{Name: localdriver.DefaultPoolName, Path: mountDir}},
+				TrashRetention: time.Hour,
+				Clock:          fakeClock,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(localDriver.Create(env, dockerdriver.CreateRequest{
+				Name: volumeId,
+				Opts: map[string]interface{}{"labels": map[string]interface{}{"suite": "smoke"}},
+			}).Err).To(Equal(""))
+			Expect(os.WriteFile(filepath.Join(expectedVolume, "data"), []byte("precious"), 0600)).To(Succeed())
+
+			removeResponse := localDriver.Remove(env, dockerdriver.RemoveRequest{Name: volumeId})
+			Expect(removeResponse.Err).To(Equal(""))
+		})
+
+		It("moves the removed volume into the trash", func() {
+			getUnsuccessful(env, localDriver, volumeId)
+			Expect(expectedVolume).NotTo(BeADirectory())
+			Expect(filepath.Join(mountDir, "_trash", trashId, "data")).To(BeAnExistingFile())
+
+			trash := localDriver.ListTrash(env)
+			Expect(trash.Volumes).To(HaveLen(1))
+			Expect(trash.Volumes[0].ID).To(Equal(trashId))
+			Expect(trash.Volumes[0].Name).To(Equal(volumeId))
+			Expect(trash.Volumes[0].Pool).To(Equal(localdriver.DefaultPoolName))
+			Expect(trash.Volumes[0].PurgeAt).To(Equal(fakeClock.Now().Add(time.Hour)))
+		})
+
+		It("restores the volume under its original name", func() {
+			restoreResponse := localDriver.Restore(env, localdriver.RestoreRequest{ID: trashId})
+			Expect(restoreResponse.Err).To(Equal(""))
+
+			contents, err := os.ReadFile(filepath.Join(expectedVolume, "data"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("precious"))
+
+			getResponse := getSuccessful(env, localDriver, volumeId)
+			Expect(getResponse.Volume.Status).To(HaveKeyWithValue("labels", map[string]string{"suite": "smoke"}))
+			Expect(localDriver.ListTrash(env).Volumes).To(BeEmpty())
+		})
+
+		It("refuses to restore when the name has been taken again", func() {
+			createSuccessful(env, localDriver, volumeId)
+
+			restoreResponse := localDriver.Restore(env, localdriver.RestoreRequest{ID: trashId})
+			Expect(restoreResponse.Err).To(Equal("Volume 'test-volume-id' already exists"))
+			Expect(localDriver.ListTrash(env).Volumes).To(HaveLen(1))
+		})
+
+		It("fails to restore an unknown trash id", func() {
+			restoreResponse := localDriver.Restore(env, localdriver.RestoreRequest{ID: "missing"})
+			Expect(restoreResponse.Err).To(Equal("Trashed volume 'missing' not found"))
+		})
+
+		It("purges the trash once the retention period has passed", func() {
+			Expect(localDriver.ReapExpired(env).Purged).To(BeEmpty())
+
+			fakeClock.Increment(time.Hour)
+			reapResponse := localDriver.ReapExpired(env)
+			Expect(reapResponse.Err).To(Equal(""))
+			Expect(reapResponse.Purged).To(Equal([]string{trashId}))
+			Expect(filepath.Join(mountDir, "_trash", trashId)).NotTo(BeADirectory())
+			Expect(localDriver.ListTrash(env).Volumes).To(BeEmpty())
+		})
+
+		Context("when the driver restarts", func() {
+			var (
+				uniqueVolumeIds bool
+				retention       time.Duration
+			)
+
+			BeforeEach(func() {
+				uniqueVolumeIds = false
+				retention = time.Hour
+			})
+
+			restart := func() {
+				localDriver, err = localdriver.NewLocalDriverWithConfig(map[string]*localdriver.LocalVolumeInfo{}, &osshim.OsShim{}, testFilepath, oshelper.NewOsHelper(), localdriver.Config{
+					Pools:           []localdriver.Pool{{Name: localdriver.DefaultPoolName, Path: mountDir}},
+					UniqueVolumeIds: uniqueVolumeIds,
+					TrashRetention:  retention,
+					Clock:           fakeClock,
+				})
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			It("finds the trashed volumes again", func() {
+				restart()
+
+				trash := localDriver.ListTrash(env)
+				Expect(trash.Volumes).To(HaveLen(1))
+				Expect(trash.Volumes[0].ID).To(Equal(trashId))
+				Expect(trash.Volumes[0].Name).To(Equal(volumeId))
+				Expect(trash.Volumes[0].Pool).To(Equal(localdriver.DefaultPoolName))
+				Expect(trash.Volumes[0].TrashedAt).To(Equal(fakeClock.Now()))
+				Expect(trash.Volumes[0].PurgeAt).To(Equal(fakeClock.Now().Add(time.Hour)))
+			})
+
+			It("restores them", func() {
+				restart()
+
+				Expect(localDriver.Restore(env, localdriver.RestoreRequest{ID: trashId}).Err).To(Equal(""))
+				contents, err := os.ReadFile(filepath.Join(expectedVolume, "data"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("precious"))
+				getSuccessful(env, localDriver, volumeId)
+			})
+
+			It("purges them once the retention period has passed", func() {
+				restart()
+
+				fakeClock.Increment(time.Hour)
+				Expect(localDriver.ReapExpired(env).Purged).To(Equal([]string{trashId}))
+				Expect(filepath.Join(mountDir, "_trash", trashId)).NotTo(BeADirectory())
+			})
+
+			It("ignores entries it did not name", func() {
+				Expect(os.Mkdir(filepath.Join(mountDir, "_trash", "lost+found"), 0700)).To(Succeed())
+				restart()
+
+				Expect(localDriver.ListTrash(env).Volumes).To(HaveLen(1))
+			})
+
+			Context("without a retention period", func() {
+				BeforeEach(func() {
+					retention = 0
+				})
+
+				It("keeps the trashed volumes until they are restored", func() {
+					restart()
+
+					fakeClock.Increment(24 * time.Hour)
+					Expect(localDriver.ReapExpired(env).Purged).To(BeEmpty())
+					Expect(filepath.Join(mountDir, "_trash", trashId)).To(BeADirectory())
+
+					trash := localDriver.ListTrash(env)
+					Expect(trash.Volumes).To(HaveLen(1))
+					Expect(trash.Volumes[0].PurgeAt).To(BeZero())
+					Expect(localDriver.Restore(env, localdriver.RestoreRequest{ID: trashId}).Err).To(Equal(""))
+				})
+			})
+
+			Context("with unique volume IDs", func() {
+				BeforeEach(func() {
+					uniqueVolumeIds = true
+				})
+
+				It("refuses to restore a volume whose name is unknown", func() {
+					restart()
+
+					restoreResponse := localDriver.Restore(env, localdriver.RestoreRequest{ID: trashId})
+					Expect(restoreResponse.Err).To(Equal("Trashed volume 'test-volume-id.20200101T000000.000000000Z' was found at startup and its original name is unknown"))
+				})
+			})
+		})
+	})
+
+	Describe("Idempotency", func() {
+		var fakeClock *fakeclock.FakeClock
+
+		BeforeEach(func() {
+			fakeClock = fakeclock.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		})
+
+		JustBeforeEach(func() {
+			localDriver, err = localdriver.NewLocalDriverWithConfig(state, testOs, testFilepath, oshelper.NewOsHelper(), localdriver.Config{
+				Pools:             []localdriver.Pool{{Name: localdriver.DefaultPoolName, Path: mountDir}},
+				IdempotencyWindow: time.Minute,
+				Clock:             fakeClock,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			createSuccessful(env, localDriver, volumeId)
+		})
+
+		mountWithKey := func(key string) dockerdriver.MountResponse {
+			return localDriver.Mount(env, dockerdriver.MountRequest{
+				Name: volumeId,
+				Opts: map[string]interface{}{localdriver.IdempotencyKeyOption: key},
+			})
+		}
+
+		mountCount := func() int {
+			return state[volumeId].MountCount
+		}
+
+		It("replays a retried mount without counting it again", func() {
+			first := mountWithKey("attempt-1")
+			Expect(first.Err).To(Equal(""))
+
+			Expect(mountWithKey("attempt-1")).To(Equal(first))
+			Expect(mountCount()).To(Equal(1))
+			Expect(testOs.SymlinkCallCount()).To(Equal(1))
+		})
+
+		It("counts mounts with different keys", func() {
+			Expect(mountWithKey("attempt-1").Err).To(Equal(""))
+			Expect(mountWithKey("attempt-2").Err).To(Equal(""))
+			Expect(mountCount()).To(Equal(2))
+		})
+
+		It("counts mounts without a key", func() {
+			mountSuccessful(env, localDriver, volumeId)
+			mountSuccessful(env, localDriver, volumeId)
+			Expect(mountCount()).To(Equal(2))
+		})
+
+		It("forgets the key once the window has passed", func() {
+			Expect(mountWithKey("attempt-1").Err).To(Equal(""))
+			fakeClock.Increment(time.Minute)
+			Expect(mountWithKey("attempt-1").Err).To(Equal(""))
+			Expect(mountCount()).To(Equal(2))
+		})
+
+		Context("with the request ID as the key", func() {
+			var requestEnv dockerdriver.Env
+
+			JustBeforeEach(func() {
+				requestEnv = driverhttp.NewHttpDriverEnv(testLogger, localdriver.WithRequestID(ctx, "container-1"))
+				mountSuccessful(env, localDriver, volumeId)
+				mountSuccessful(requestEnv, localDriver, volumeId)
+				mountSuccessful(requestEnv, localDriver, volumeId)
+			})
+
+			It("replays a retried mount", func() {
+				Expect(mountCount()).To(Equal(2))
+			})
+
+			It("replays a retried unmount without releasing the volume twice", func() {
+				unmountSuccessful(requestEnv, localDriver, volumeId)
+				unmountSuccessful(requestEnv, localDriver, volumeId)
+				Expect(mountCount()).To(Equal(1))
+				Expect(state[volumeId].Mountpoint).NotTo(BeEmpty())
+			})
+
+			It("treats a mount after an unmount as a new call", func() {
+				unmountSuccessful(requestEnv, localDriver, volumeId)
+				mountSuccessful(requestEnv, localDriver, volumeId)
+				Expect(mountCount()).To(Equal(2))
+			})
+		})
+
+		It("forgets the keys of a removed volume", func() {
+			Expect(mountWithKey("attempt-1").Err).To(Equal(""))
+			unmountSuccessful(env, localDriver, volumeId)
+			Expect(localDriver.Remove(env, dockerdriver.RemoveRequest{Name: volumeId}).Err).To(Equal(""))
+
+			createSuccessful(env, localDriver, volumeId)
+			Expect(mountWithKey("attempt-1").Err).To(Equal(""))
+			Expect(mountCount()).To(Equal(1))
+		})
+	})
+
+	Describe("Holders", func() {
+		var firstEnv, secondEnv dockerdriver.Env
+
+		BeforeEach(func() {
+			firstEnv = driverhttp.NewHttpDriverEnv(testLogger, localdriver.WithRequestID(ctx, "container-1"))
+			secondEnv = driverhttp.NewHttpDriverEnv(testLogger, localdriver.WithRequestID(ctx, "container-2"))
+		})
+
+		JustBeforeEach(func() {
+			createSuccessful(env, localDriver, volumeId)
+			mountSuccessful(firstEnv, localDriver, volumeId)
+			mountSuccessful(secondEnv, localDriver, volumeId)
+		})
+
+		holderMounts := func(holder string) string {
+			return filepath.Join(mountDir, "_mounts", volumeId, holder)
+		}
+
+		It("lists the holders in Get and List", func() {
+			getResponse := getSuccessful(env, localDriver, volumeId)
+			Expect(getResponse.Volume.Status["holders"]).To(Equal([]string{"container-1", "container-2"}))
+
+			listResponse := localDriver.List(env)
+			Expect(listResponse.Volumes[0].Status["holders"]).To(Equal([]string{"container-1", "container-2"}))
+		})
+
+		It("gives each holder its own mountpoint", func() {
+			Expect(testOs.SymlinkCallCount()).To(Equal(2))
+			src, tgt := testOs.SymlinkArgsForCall(0)
+			Expect(src).To(Equal(expectedVolume))
+			Expect(tgt).To(Equal(holderMounts("container-1")))
+			src, tgt = testOs.SymlinkArgsForCall(1)
+			Expect(src).To(Equal(expectedVolume))
+			Expect(tgt).To(Equal(holderMounts("container-2")))
+		})
+
+		It("counts a holder only once", func() {
+			mountResponse := localDriver.Mount(firstEnv, dockerdriver.MountRequest{Name: volumeId})
+			Expect(mountResponse.Err).To(Equal(""))
+			Expect(mountResponse.Mountpoint).To(Equal(holderMounts("container-1")))
+			Expect(state[volumeId].MountCount).To(Equal(2))
+			Expect(testOs.SymlinkCallCount()).To(Equal(2))
+		})
+
+		It("releases only the mount of the holder that unmounts", func() {
+			unmountSuccessful(firstEnv, localDriver, volumeId)
+			Expect(state[volumeId].MountCount).To(Equal(1))
+			Expect(testOs.RemoveCallCount()).To(Equal(1))
+			Expect(testOs.RemoveArgsForCall(0)).To(Equal(holderMounts("container-1")))
+			Expect(state[volumeId].Mountpoint).To(Equal(holderMounts("container-2")))
+
+			getResponse := getSuccessful(env, localDriver, volumeId)
+			Expect(getResponse.Volume.Status["holders"]).To(Equal([]string{"container-2"}))
+
+			unmountSuccessful(secondEnv, localDriver, volumeId)
+			Expect(state[volumeId].Mountpoint).To(BeEmpty())
+			Expect(testOs.RemoveCallCount()).To(Equal(3))
+			Expect(testOs.RemoveArgsForCall(1)).To(Equal(holderMounts("container-2")))
+			Expect(testOs.RemoveArgsForCall(2)).To(Equal(filepath.Dir(holderMounts("container-2"))))
+		})
+
+		It("rejects an ID that cannot name a mountpoint", func() {
+			otherEnv := driverhttp.NewHttpDriverEnv(testLogger, localdriver.WithRequestID(ctx, "../escape"))
+			mountResponse := localDriver.Mount(otherEnv, dockerdriver.MountRequest{Name: volumeId})
+			Expect(mountResponse.Err).To(Equal("Invalid container ID '../escape'"))
+		})
+
+		It("refuses an unmount by a caller that does not hold the volume", func() {
+			otherEnv := driverhttp.NewHttpDriverEnv(testLogger, localdriver.WithRequestID(ctx, "container-3"))
+			unmountResponse := localDriver.Unmount(otherEnv, dockerdriver.UnmountRequest{Name: volumeId})
+			Expect(unmountResponse.Err).To(Equal("Volume 'test-volume-id' is not mounted by 'container-3'"))
+			Expect(state[volumeId].MountCount).To(Equal(2))
+		})
+
+		It("refuses an unmount without an ID", func() {
+			unmountResponse := localDriver.Unmount(env, dockerdriver.UnmountRequest{Name: volumeId})
+			Expect(unmountResponse.Err).To(ContainSubstring("is mounted by container-1, container-2"))
+			Expect(state[volumeId].MountCount).To(Equal(2))
+		})
+
+		Context("when the volume is also mounted without an ID", func() {
+			JustBeforeEach(func() {
+				mountSuccessful(env, localDriver, volumeId)
+			})
+
+			It("mounts it at the shared mountpoint", func() {
+				Expect(state[volumeId].Mountpoint).To(Equal(expectedMounts))
+			})
+
+			It("releases the anonymous mount on an unmount without an ID", func() {
+				unmountSuccessful(env, localDriver, volumeId)
+				Expect(state[volumeId].MountCount).To(Equal(2))
+				Expect(state[volumeId].Holders).To(HaveLen(2))
+				Expect(testOs.RemoveArgsForCall(0)).To(Equal(expectedMounts))
+			})
+
+			It("unmounts every holder when the volume is removed", func() {
+				Expect(localDriver.Remove(env, dockerdriver.RemoveRequest{Name: volumeId}).Err).To(Equal(""))
+				Expect(testOs.RemoveCallCount()).To(Equal(4))
+			})
+		})
+	})
+
+	Describe("Subpaths", func() {
+		var holderEnv dockerdriver.Env
+
+		BeforeEach(func() {
+			holderEnv = driverhttp.NewHttpDriverEnv(testLogger, localdriver.WithRequestID(ctx, "container-1"))
+		})
+
+		JustBeforeEach(func() {
+			createSuccessful(env, localDriver, volumeId)
+		})
+
+		mountSubpath := func(env dockerdriver.Env, subpath interface{}) dockerdriver.MountResponse {
+			return localDriver.Mount(env, dockerdriver.MountRequest{
+				Name: volumeId,
+				Opts: map[string]interface{}{localdriver.SubpathOption: subpath},
+			})
+		}
+
+		It("mounts a directory inside the volume, creating it", func() {
+			testOs.LstatReturns(nil, os.ErrNotExist)
+			testOs.GetuidReturns(1000)
+			testOs.GetgidReturns(1001)
+			createSuccessful(env, localDriver, "owned-volume")
+			Expect(localDriver.Mount(holderEnv, dockerdriver.MountRequest{
+				Name: "owned-volume",
+				Opts: map[string]interface{}{localdriver.SubpathOption: "services/web/"},
+			}).Err).To(Equal(""))
+
+			ownedVolume := filepath.Join(mountDir, "_volumes", "owned-volume")
+			Expect(testOs.MkdirCallCount()).To(Equal(2))
+			created, mode := testOs.MkdirArgsForCall(0)
+			Expect(created).To(Equal(filepath.Join(ownedVolume, "services")))
+			Expect(mode).To(Equal(localdriver.DefaultVolumeMode))
+			created, _ = testOs.MkdirArgsForCall(1)
+			Expect(created).To(Equal(filepath.Join(ownedVolume, "services", "web")))
+
+			chowned, uid, gid := testOs.ChownArgsForCall(1)
+			Expect(chowned).To(Equal(filepath.Join(ownedVolume, "services", "web")))
+			Expect(uid).To(Equal(1000))
+			Expect(gid).To(Equal(1001))
+			modes := map[string]os.FileMode{}
+			for i := 0; i < testOs.ChmodCallCount(); i++ {
+				chmodded, mode := testOs.ChmodArgsForCall(i)
+				modes[chmodded] = mode
+			}
+			Expect(modes).To(HaveKeyWithValue(filepath.Join(ownedVolume, "services", "web"), localdriver.DefaultVolumeMode))
+		})
+
+		It("reports the subpath of each holder", func() {
+			mountResponse := mountSubpath(holderEnv, "services/web/")
+			Expect(mountResponse.Err).To(Equal(""))
+			Expect(mountResponse.Mountpoint).To(Equal(filepath.Join(mountDir, "_mounts", volumeId, "container-1")))
+
+			Expect(testOs.MkdirCallCount()).To(BeZero())
+			src, _ := testOs.SymlinkArgsForCall(0)
+			Expect(src).To(Equal(filepath.Join(expectedVolume, "services", "web")))
+
+			getResponse := getSuccessful(env, localDriver, volumeId)
+			Expect(getResponse.Volume.Status["subpaths"]).To(Equal(map[string]string{"container-1": "services/web"}))
+		})
+
+		It("mounts the whole volume for the volume root", func() {
+			Expect(mountSubpath(holderEnv, ".").Err).To(Equal(""))
+			src, _ := testOs.SymlinkArgsForCall(0)
+			Expect(src).To(Equal(expectedVolume))
+		})
+
+		DescribeTable("refuses subpaths that leave the volume",
+			func(subpath string) {
+				mountResponse := mountSubpath(holderEnv, subpath)
+				Expect(mountResponse.Err).To(Equal(fmt.Sprintf("Invalid 'subpath' option: '%s' must stay inside the volume", subpath)))
+				Expect(testOs.SymlinkCallCount()).To(BeZero())
+			},
+			Entry("parent", ".."),
+			Entry("sibling", "../other-volume"),
+			Entry("nested parent", "services/../../other-volume"),
+			Entry("absolute", "/etc"),
+		)
+
+		It("refuses a subpath through a symlink", func() {
+			linkDir, err := os.MkdirTemp("", "subpath")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(linkDir)
+			Expect(os.Symlink("/etc", filepath.Join(linkDir, "link"))).To(Succeed())
+			linkInfo, err := os.Lstat(filepath.Join(linkDir, "link"))
+			Expect(err).NotTo(HaveOccurred())
+
+			testOs.LstatStub = func(name string) (os.FileInfo, error) {
+				if name == filepath.Join(expectedVolume, "services") {
+					return linkInfo, nil
+				}
+				return nil, os.ErrNotExist
+			}
+
+			mountResponse := mountSubpath(holderEnv, "services/web")
+			Expect(mountResponse.Err).To(Equal("Invalid 'subpath' option: 'services/web' is a symlink"))
+			Expect(testOs.SymlinkCallCount()).To(BeZero())
+		})
+
+		It("requires the ID of the mounting container", func() {
+			Expect(mountSubpath(env, "services/web").Err).To(Equal("The 'subpath' option requires the ID of the mounting container"))
+		})
+
+		It("refuses a second mount of a different subpath by the same holder", func() {
+			Expect(mountSubpath(holderEnv, "services/web").Err).To(Equal(""))
+			Expect(mountSubpath(holderEnv, "services/db").Err).To(Equal("Volume 'test-volume-id' is already mounted by 'container-1' at subpath 'services/web'"))
+		})
+	})
+
+	Describe("Copy-on-write", func() {
+		var (
+			osHelper     *layerOsHelper
+			layerOs      osshim.Os
+			holderEnv    dockerdriver.Env
+			sourceVolume string
+			layerDir     string
+		)
+
+		BeforeEach(func() {
+			osHelper = &layerOsHelper{OsHelper: oshelper.NewOsHelper()}
+			layerOs = &osshim.OsShim{}
+			holderEnv = driverhttp.NewHttpDriverEnv(testLogger, localdriver.WithRequestID(ctx, "container-1"))
+			sourceVolume = filepath.Join(mountDir, "_volumes", volumeId)
+			layerDir = filepath.Join(mountDir, "_layers", volumeId, "container-1")
+		})
+
+		JustBeforeEach(func() {
+			localDriver, err = localdriver.NewLocalDriverWithConfig(state, layerOs, testFilepath, osHelper, localdriver.Config{
+				Pools: []localdriver.Pool{{Name: localdriver.DefaultPoolName, Path: mountDir}},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			createSuccessful(env, localDriver, volumeId)
+			Expect(os.WriteFile(filepath.Join(sourceVolume, "fixture"), []byte("original"), 0644)).To(Succeed())
+		})
+
+		mountCopyOnWrite := func(env dockerdriver.Env) dockerdriver.MountResponse {
+			return localDriver.Mount(env, dockerdriver.MountRequest{
+				Name: volumeId,
+				Opts: map[string]interface{}{localdriver.CopyOnWriteOption: true},
+			})
+		}
+
+		It("requires the ID of the mounting container", func() {
+			Expect(mountCopyOnWrite(env).Err).To(Equal("The 'copy_on_write' option requires the ID of the mounting container"))
+		})
+
+		Context("when overlayfs can be mounted", func() {
+			It("mounts an overlay over the volume and unmounts it on Unmount", func() {
+				mountResponse := mountCopyOnWrite(holderEnv)
+				Expect(mountResponse.Err).To(Equal(""))
+
+				Expect(osHelper.overlays).To(ConsistOf([]string{sourceVolume, filepath.Join(layerDir, "upper"), filepath.Join(layerDir, "work"), filepath.Join(layerDir, "merged")}))
+				target, err := os.Readlink(mountResponse.Mountpoint)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(target).To(Equal(filepath.Join(layerDir, "merged")))
+
+				getResponse := getSuccessful(env, localDriver, volumeId)
+				Expect(getResponse.Volume.Status["layers"]).To(Equal(map[string]string{"container-1": localdriver.LayerOverlay}))
+
+				unmountSuccessful(holderEnv, localDriver, volumeId)
+				Expect(osHelper.unmounted).To(ConsistOf(filepath.Join(layerDir, "merged")))
+				Expect(layerDir).NotTo(BeADirectory())
+			})
+		})
+
+		Context("when overlayfs is not available", func() {
+			BeforeEach(func() {
+				osHelper.overlayErr = errors.New("operation not permitted")
+			})
+
+			It("mounts a private copy of the volume and discards it on Unmount", func() {
+				mountResponse := mountCopyOnWrite(holderEnv)
+				Expect(mountResponse.Err).To(Equal(""))
+
+				Expect(os.WriteFile(filepath.Join(mountResponse.Mountpoint, "fixture"), []byte("changed"), 0644)).To(Succeed())
+				contents, err := os.ReadFile(filepath.Join(sourceVolume, "fixture"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("original"))
+
+				getResponse := getSuccessful(env, localDriver, volumeId)
+				Expect(getResponse.Volume.Status["layers"]).To(Equal(map[string]string{"container-1": localdriver.LayerCopy}))
+
+				unmountSuccessful(holderEnv, localDriver, volumeId)
+				Expect(osHelper.unmounted).To(BeEmpty())
+				Expect(layerDir).NotTo(BeADirectory())
+				Expect(filepath.Join(sourceVolume, "fixture")).To(BeARegularFile())
+			})
+
+			It("keeps the layers of different holders apart", func() {
+				otherEnv := driverhttp.NewHttpDriverEnv(testLogger, localdriver.WithRequestID(ctx, "container-2"))
+				first := mountCopyOnWrite(holderEnv)
+				second := mountCopyOnWrite(otherEnv)
+
+				Expect(os.WriteFile(filepath.Join(first.Mountpoint, "fixture"), []byte("changed"), 0644)).To(Succeed())
+				contents, err := os.ReadFile(filepath.Join(second.Mountpoint, "fixture"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("original"))
+			})
+
+			Context("when the driver may not change owners", func() {
+				BeforeEach(func() {
+					layerOs = &unprivilegedOs{}
+				})
+
+				It("leaves the copy owned by the driver", func() {
+					Expect(os.Chmod(filepath.Join(sourceVolume, "fixture"), 0644|os.ModeSetuid)).To(Succeed())
+
+					mountResponse := mountCopyOnWrite(holderEnv)
+					Expect(mountResponse.Err).To(Equal(""))
+
+					info, err := os.Stat(filepath.Join(mountResponse.Mountpoint, "fixture"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(info.Mode()).To(Equal(os.FileMode(0644)))
+				})
+			})
+
+			Context("while the volume is being copied", func() {
+				var copying *blockingOs
+
+				BeforeEach(func() {
+					copying = &blockingOs{started: make(chan struct{}), release: make(chan struct{})}
+					layerOs = copying
+				})
+
+				It("keeps serving other calls and refuses to use the volume", func() {
+					mounted := make(chan dockerdriver.MountResponse)
+					go func() {
+						mounted <- mountCopyOnWrite(holderEnv)
+					}()
+					Eventually(copying.started).Should(BeClosed())
+
+					listed := make(chan dockerdriver.ListResponse)
+					go func() {
+						listed <- localDriver.List(env)
+					}()
+					Eventually(listed).Should(Receive())
+
+					Expect(mountCopyOnWrite(holderEnv).Err).To(Equal("Volume 'test-volume-id' is already being mounted by 'container-1'"))
+					removeResponse := localDriver.Remove(env, dockerdriver.RemoveRequest{Name: volumeId})
+					Expect(removeResponse.Err).To(Equal("Volume 'test-volume-id' is being mounted"))
+
+					close(copying.release)
+					var mountResponse dockerdriver.MountResponse
+					Eventually(mounted).Should(Receive(&mountResponse))
+					Expect(mountResponse.Err).To(Equal(""))
+					Expect(filepath.Join(mountResponse.Mountpoint, "fixture")).To(BeARegularFile())
+					unmountSuccessful(holderEnv, localDriver, volumeId)
+				})
+			})
+		})
+	})
+
+	Describe("Memory volumes", func() {
+		var (
+			osHelper   *memoryOsHelper
+			memoryDir  string
+			volumePath string
+		)
+
+		BeforeEach(func() {
+			osHelper = &memoryOsHelper{OsHelper: oshelper.NewOsHelper(), tmpfs: map[string]uint64{}}
+			memoryDir, err = os.MkdirTemp("", "localDriverShm")
+			Expect(err).NotTo(HaveOccurred())
+			volumePath = filepath.Join(mountDir, "_volumes", volumeId)
+		})
+
+		JustBeforeEach(func() {
+			localDriver, err = localdriver.NewLocalDriverWithConfig(state, &osshim.OsShim{}, testFilepath, osHelper, localdriver.Config{
+				Pools:               []localdriver.Pool{{Name: localdriver.DefaultPoolName, Path: mountDir}},
+				TrashRetention:      time.Hour,
+				SharedMemoryDir:     memoryDir,
+				MaxMemoryVolumeSize: 32 * 1024 * 1024,
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(memoryDir)
+		})
+
+		createInMemory := func(opts map[string]interface{}) dockerdriver.ErrorResponse {
+			opts[localdriver.MediumOption] = localdriver.MediumMemory
+			return localDriver.Create(env, dockerdriver.CreateRequest{Name: volumeId, Opts: opts})
+		}
+
+		Context("when tmpfs can be mounted", func() {
+			It("mounts a tmpfs of the given size on the volume and unmounts it on Remove", func() {
+				Expect(createInMemory(map[string]interface{}{"size": "16M"}).Err).To(Equal(""))
+				Expect(osHelper.tmpfs).To(Equal(map[string]uint64{volumePath: 16 * 1024 * 1024}))
+
+				getResponse := getSuccessful(env, localDriver, volumeId)
+				Expect(getResponse.Volume.Status["medium"]).To(Equal(localdriver.MediumMemory))
+				Expect(getResponse.Volume.Status["memory"]).To(Equal(localdriver.MemoryTmpfs))
+				Expect(getResponse.Volume.Status["size"]).To(Equal(uint64(16 * 1024 * 1024)))
+
+				removeResponse := localDriver.Remove(env, dockerdriver.RemoveRequest{Name: volumeId})
+				Expect(removeResponse.Err).To(Equal(""))
+				Expect(osHelper.unmounted).To(ConsistOf(volumePath))
+				Expect(volumePath).NotTo(BeADirectory())
+				Expect(filepath.Join(mountDir, "_trash")).NotTo(BeADirectory())
+			})
+
+			It("uses the driver's limit as the size when none is given", func() {
+				Expect(createInMemory(map[string]interface{}{}).Err).To(Equal(""))
+				Expect(osHelper.tmpfs).To(Equal(map[string]uint64{volumePath: 32 * 1024 * 1024}))
+			})
+
+			It("resizes the tmpfs", func() {
+				Expect(createInMemory(map[string]interface{}{"size": "16M"}).Err).To(Equal(""))
+
+				resizeResponse := localDriver.Resize(env, localdriver.ResizeRequest{Name: volumeId, Size: 8 * 1024 * 1024})
+				Expect(resizeResponse.Err).To(Equal(""))
+				Expect(osHelper.tmpfs).To(Equal(map[string]uint64{volumePath: 8 * 1024 * 1024}))
+				Expect(getSuccessful(env, localDriver, volumeId).Volume.Status["size"]).To(Equal(uint64(8 * 1024 * 1024)))
+			})
+
+			It("does not resize past the driver's limit", func() {
+				Expect(createInMemory(map[string]interface{}{"size": "16M"}).Err).To(Equal(""))
+
+				resizeResponse := localDriver.Resize(env, localdriver.ResizeRequest{Name: volumeId, Size: 64 * 1024 * 1024})
+				Expect(resizeResponse.Err).To(Equal("Memory volumes are limited to 32M"))
+				Expect(osHelper.tmpfs).To(Equal(map[string]uint64{volumePath: 16 * 1024 * 1024}))
+			})
+
+			It("keeps the volume when the tmpfs cannot be unmounted", func() {
+				Expect(createInMemory(map[string]interface{}{}).Err).To(Equal(""))
+				osHelper.unmountErr = errors.New("device or resource busy")
+
+				removeResponse := localDriver.Remove(env, dockerdriver.RemoveRequest{Name: volumeId})
+				Expect(removeResponse.Err).To(Equal("Failed removing mount path: device or resource busy"))
+				getSuccessful(env, localDriver, volumeId)
+			})
+		})
+
+		Context("when tmpfs is not available", func() {
+			BeforeEach(func() {
+				osHelper.tmpfsErr = errors.New("operation not permitted")
+			})
+
+			It("keeps the volume in the shared memory directory and drops it on Remove", func() {
+				Expect(createInMemory(map[string]interface{}{"mode": "0750"}).Err).To(Equal(""))
+
+				sharedDir := filepath.Join(memoryDir, "localdriver", volumeId)
+				target, err := os.Readlink(volumePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(target).To(Equal(sharedDir))
+				info, err := os.Stat(sharedDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0750)))
+
+				mountResponse := localDriver.Mount(env, dockerdriver.MountRequest{Name: volumeId})
+				Expect(mountResponse.Err).To(Equal(""))
+				Expect(os.WriteFile(filepath.Join(mountResponse.Mountpoint, "scratch"), []byte("data"), 0644)).To(Succeed())
+				Expect(filepath.Join(sharedDir, "scratch")).To(BeARegularFile())
+
+				getResponse := getSuccessful(env, localDriver, volumeId)
+				Expect(getResponse.Volume.Status["memory"]).To(Equal(localdriver.MemoryShared))
+
+				removeResponse := localDriver.Remove(env, dockerdriver.RemoveRequest{Name: volumeId})
+				Expect(removeResponse.Err).To(Equal(""))
+				Expect(sharedDir).NotTo(BeADirectory())
+				_, err = os.Lstat(volumePath)
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+
+			It("refuses a size it cannot enforce", func() {
+				createResponse := createInMemory(map[string]interface{}{"size": "16M"})
+				Expect(createResponse.Err).To(Equal("Failed creating memory volume: the 'size' option cannot be enforced without tmpfs: operation not permitted"))
+				_, err := os.Lstat(volumePath)
+				Expect(os.IsNotExist(err)).To(BeTrue())
+				Expect(filepath.Join(memoryDir, "localdriver", volumeId)).NotTo(BeADirectory())
+
+				getResponse := localDriver.Get(env, dockerdriver.GetRequest{Name: volumeId})
+				Expect(getResponse.Err).To(Equal("Volume not found"))
+			})
+
+			It("refuses to resize the volume", func() {
+				Expect(createInMemory(map[string]interface{}{}).Err).To(Equal(""))
+
+				resizeResponse := localDriver.Resize(env, localdriver.ResizeRequest{Name: volumeId, Size: 16 * 1024 * 1024})
+				Expect(resizeResponse.Err).To(Equal("Volume 'test-volume-id' is kept in shared memory, where its size cannot be enforced"))
+				Expect(getSuccessful(env, localDriver, volumeId).Volume.Status["size"]).To(Equal(uint64(32 * 1024 * 1024)))
+			})
+
+			It("refuses the volume when shared memory does not have room for it", func() {
+				osHelper.free = 8 * 1024 * 1024
+
+				createResponse := createInMemory(map[string]interface{}{})
+				Expect(createResponse.Err).To(ContainSubstring("Failed creating memory volume: " + memoryDir + " has 8M free"))
+				_, err := os.Lstat(volumePath)
+				Expect(os.IsNotExist(err)).To(BeTrue())
+
+				getResponse := localDriver.Get(env, dockerdriver.GetRequest{Name: volumeId})
+				Expect(getResponse.Err).To(Equal("Volume not found"))
+			})
+		})
+
+		DescribeTable("refuses invalid options",
+			func(opts map[string]interface{}, message string) {
+				createResponse := localDriver.Create(env, dockerdriver.CreateRequest{Name: volumeId, Opts: opts})
+				Expect(createResponse.Err).To(Equal(message))
+				Expect(osHelper.tmpfs).To(BeEmpty())
+			},
+			Entry("an unknown medium", map[string]interface{}{"medium": "tape"}, "Invalid 'medium' option: tape"),
+			Entry("a size above the limit", map[string]interface{}{"medium": "memory", "size": "1G"}, "Invalid 'size' option: memory volumes are limited to 32M"),
+			Entry("a size that is not a size", map[string]interface{}{"medium": "memory", "size": "lots"}, "Invalid 'size' option: lots"),
+			Entry("a fractional size", map[string]interface{}{"medium": "memory", "size": 1.5}, "Invalid 'size' option: 1.5"),
+			Entry("a size for a disk volume", map[string]interface{}{"size": "16M"}, "The 'size' option requires the 'memory' medium or the 'image' backend"),
+		)
+	})
+
+	Describe("Image volumes", func() {
+		var (
+			osHelper   *imageOsHelper
+			volumePath string
+			imagePath  string
+			dataPath   string
+		)
+
+		BeforeEach(func() {
+			osHelper = &imageOsHelper{OsHelper: oshelper.NewOsHelper()}
+			volumePath = filepath.Join(mountDir, "_volumes", volumeId)
+			imagePath = filepath.Join(volumePath, "image")
+			dataPath = filepath.Join(volumePath, "fs")
+		})
+
+		JustBeforeEach(func() {
+			localDriver, err = localdriver.NewLocalDriverWithConfig(state, &osshim.OsShim{}, testFilepath, osHelper, localdriver.Config{
+				Pools: []localdriver.Pool{{Name: localdriver.DefaultPoolName, Path: mountDir}},
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		createImage := func(opts map[string]interface{}) dockerdriver.ErrorResponse {
+			opts[localdriver.BackendOption] = localdriver.BackendImage
+			return localDriver.Create(env, dockerdriver.CreateRequest{Name: volumeId, Opts: opts})
+		}
+
+		It("creates an image of the given size and sets up its root while it is mounted", func() {
+			Expect(createImage(map[string]interface{}{"size": "100M", "mode": "0700"}).Err).To(Equal(""))
+
+			Expect(osHelper.images).To(Equal(map[string]uint64{imagePath: 100 * 1024 * 1024}))
+			Expect(osHelper.mounted).To(Equal([]string{dataPath}))
+			Expect(osHelper.unmounted).To(Equal([]string{dataPath}))
+			info, err := os.Stat(dataPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0700)))
+
+			info, err = os.Stat(volumePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(localdriver.DefaultVolumeMode))
+
+			getResponse := getSuccessful(env, localDriver, volumeId)
+			Expect(getResponse.Volume.Status["backend"]).To(Equal(localdriver.BackendImage))
+			Expect(getResponse.Volume.Status["size"]).To(Equal(uint64(100 * 1024 * 1024)))
+		})
+
+		It("fails clearly when loop devices are not available", func() {
+			osHelper.mountErr = errors.New("loop devices are not available: stat /dev/loop-control: no such file or directory")
+
+			createResponse := createImage(map[string]interface{}{"size": "100M"})
+			Expect(createResponse.Err).To(Equal("Failed creating image volume: loop devices are not available: stat /dev/loop-control: no such file or directory"))
+			Expect(volumePath).NotTo(BeADirectory())
+			Expect(localDriver.Get(env, dockerdriver.GetRequest{Name: volumeId}).Err).To(Equal("Volume not found"))
+		})
+
+		Context("when the image cannot be unmounted after setting it up", func() {
+			BeforeEach(func() {
+				osHelper.unmountErr = errors.New("device or resource busy")
+			})
+
+			It("fails the create and leaves the image to be cleaned up", func() {
+				createResponse := createImage(map[string]interface{}{"size": "100M"})
+				Expect(createResponse.Err).To(Equal("Failed creating image volume: device or resource busy"))
+				Expect(localDriver.Get(env, dockerdriver.GetRequest{Name: volumeId}).Err).To(Equal("Volume not found"))
+				Expect(imagePath).To(BeARegularFile())
+
+				reapResponse := localDriver.ReapExpired(env)
+				Expect(reapResponse.Err).To(Equal("Failed removing expired volumes: [device or resource busy]"))
+				Expect(imagePath).To(BeARegularFile())
+
+				osHelper.unmountErr = nil
+				Expect(localDriver.ReapExpired(env).Err).To(Equal(""))
+				Expect(osHelper.unmounted).To(Equal([]string{dataPath}))
+				Expect(volumePath).NotTo(BeADirectory())
+			})
+
+			It("cleans up the image before creating the volume again", func() {
+				Expect(createImage(map[string]interface{}{"size": "100M"}).Err).To(Equal("Failed creating image volume: device or resource busy"))
+
+				createResponse := createImage(map[string]interface{}{"size": "100M"})
+				Expect(createResponse.Err).To(Equal("Failed cleaning up the image left by an earlier create: device or resource busy"))
+				Expect(localDriver.Get(env, dockerdriver.GetRequest{Name: volumeId}).Err).To(Equal("Volume not found"))
+
+				osHelper.unmountErr = nil
+				Expect(createImage(map[string]interface{}{"size": "100M"}).Err).To(Equal(""))
+				Expect(osHelper.unmounted).To(Equal([]string{dataPath, dataPath}))
+				getSuccessful(env, localDriver, volumeId)
+			})
+		})
+
+		DescribeTable("refuses invalid options",
+			func(opts map[string]interface{}, message string) {
+				createResponse := localDriver.Create(env, dockerdriver.CreateRequest{Name: volumeId, Opts: opts})
+				Expect(createResponse.Err).To(Equal(message))
+				Expect(osHelper.images).To(BeEmpty())
+			},
+			Entry("an unknown backend", map[string]interface{}{"backend": "floppy"}, "Invalid 'backend' option: floppy"),
+			Entry("no size", map[string]interface{}{"backend": "image"}, "The 'image' backend requires the 'size' option"),
+			Entry("the memory medium", map[string]interface{}{"backend": "image", "medium": "memory", "size": "16M"}, "The 'image' backend cannot be used with the 'memory' medium"),
+		)
+
+		Context("when the volume exists", func() {
+			JustBeforeEach(func() {
+				Expect(createImage(map[string]interface{}{"size": "100M"}).Err).To(Equal(""))
+				osHelper.mounted, osHelper.unmounted = nil, nil
+			})
+
+			It("mounts the image while any caller holds the volume", func() {
+				holderEnv := driverhttp.NewHttpDriverEnv(testLogger, localdriver.WithRequestID(ctx, "container-1"))
+				mountResponse := localDriver.Mount(holderEnv, dockerdriver.MountRequest{Name: volumeId})
+				Expect(mountResponse.Err).To(Equal(""))
+				mountSuccessful(env, localDriver, volumeId)
+
+				Expect(osHelper.mounted).To(Equal([]string{dataPath}))
+				target, err := os.Readlink(mountResponse.Mountpoint)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(target).To(Equal(dataPath))
+
+				unmountSuccessful(holderEnv, localDriver, volumeId)
+				Expect(osHelper.unmounted).To(BeEmpty())
+				unmountSuccessful(env, localDriver, volumeId)
+				Expect(osHelper.unmounted).To(Equal([]string{dataPath}))
+			})
+
+			It("does not keep the image mounted when the mount fails", func() {
+				holderEnv := driverhttp.NewHttpDriverEnv(testLogger, localdriver.WithRequestID(ctx, "container-1"))
+				Expect(os.Symlink("/etc", filepath.Join(dataPath, "escape"))).To(Succeed())
+
+				mountResponse := localDriver.Mount(holderEnv, dockerdriver.MountRequest{
+					Name: volumeId,
+					Opts: map[string]interface{}{localdriver.SubpathOption: "escape"},
+				})
+				Expect(mountResponse.Err).To(Equal("Invalid 'subpath' option: 'escape' is a symlink"))
+				Expect(osHelper.unmounted).To(Equal([]string{dataPath}))
+			})
+
+			It("unmounts the image before removing the volume", func() {
+				mountSuccessful(env, localDriver, volumeId)
+
+				removeResponse := localDriver.Remove(env, dockerdriver.RemoveRequest{Name: volumeId})
+				Expect(removeResponse.Err).To(Equal(""))
+				Expect(osHelper.unmounted).To(Equal([]string{dataPath}))
+				Expect(volumePath).NotTo(BeADirectory())
+			})
+
+			Describe("#Resize", func() {
+				It("grows the image and records the new size", func() {
+					mountSuccessful(env, localDriver, volumeId)
+
+					resizeResponse := localDriver.Resize(env, localdriver.ResizeRequest{Name: volumeId, Size: 200 * 1024 * 1024})
+					Expect(resizeResponse.Err).To(Equal(""))
+					Expect(osHelper.resized).To(Equal(map[string]uint64{imagePath: 200 * 1024 * 1024}))
+
+					getResponse := getSuccessful(env, localDriver, volumeId)
+					Expect(getResponse.Volume.Status["size"]).To(Equal(uint64(200 * 1024 * 1024)))
+				})
+
+				It("shrinks the image while it is not mounted", func() {
+					Expect(os.WriteFile(filepath.Join(dataPath, "data"), make([]byte, 1024), 0644)).To(Succeed())
+
+					resizeResponse := localDriver.Resize(env, localdriver.ResizeRequest{Name: volumeId, Size: 50 * 1024 * 1024})
+					Expect(resizeResponse.Err).To(Equal(""))
+					Expect(osHelper.resized).To(Equal(map[string]uint64{imagePath: 50 * 1024 * 1024}))
+					Expect(osHelper.mounted).To(Equal([]string{dataPath}))
+					Expect(osHelper.unmounted).To(Equal([]string{dataPath}))
+				})
+
+				It("refuses to shrink the image while it is mounted", func() {
+					mountSuccessful(env, localDriver, volumeId)
+
+					resizeResponse := localDriver.Resize(env, localdriver.ResizeRequest{Name: volumeId, Size: 50 * 1024 * 1024})
+					Expect(resizeResponse.Err).To(Equal("Volume 'test-volume-id' is mounted and can only grow"))
+					Expect(osHelper.resized).To(BeEmpty())
+				})
+
+				It("refuses to shrink the volume below what it uses", func() {
+					Expect(os.WriteFile(filepath.Join(dataPath, "data"), make([]byte, 8192), 0644)).To(Succeed())
+
+					resizeResponse := localDriver.Resize(env, localdriver.ResizeRequest{Name: volumeId, Size: 4096})
+					Expect(resizeResponse.Err).To(Equal("Volume 'test-volume-id' uses 8K, more than 4K"))
+					Expect(osHelper.resized).To(BeEmpty())
+					Expect(getSuccessful(env, localDriver, volumeId).Volume.Status["size"]).To(Equal(uint64(100 * 1024 * 1024)))
+				})
+
+				It("refuses volumes without a size", func() {
+					createSuccessful(env, localDriver, "other-volume")
+
+					resizeResponse := localDriver.Resize(env, localdriver.ResizeRequest{Name: "other-volume", Size: 200 * 1024 * 1024})
+					Expect(resizeResponse.Err).To(Equal("Volume 'other-volume' has no size limit to change"))
+				})
+
+				It("reports the error when resizing fails", func() {
+					osHelper.resizeErr = errors.New("resize2fs: exit status 1")
+
+					resizeResponse := localDriver.Resize(env, localdriver.ResizeRequest{Name: volumeId, Size: 200 * 1024 * 1024})
+					Expect(resizeResponse.Err).To(Equal("Failed resizing volume: resize2fs: exit status 1"))
+					Expect(getSuccessful(env, localDriver, volumeId).Volume.Status["size"]).To(Equal(uint64(100 * 1024 * 1024)))
+				})
+			})
+		})
+	})
+
+	Describe("Leases", func() {
+		var (
+			fakeClock *fakeclock.FakeClock
+			holderEnv dockerdriver.Env
+			leases    bool
+		)
+
+		BeforeEach(func() {
+			fakeClock = fakeclock.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+			holderEnv = driverhttp.NewHttpDriverEnv(testLogger, localdriver.WithRequestID(ctx, "container-1"))
+			leases = true
+		})
+
+		JustBeforeEach(func() {
+			localDriver, err = localdriver.NewLocalDriverWithConfig(state, testOs, testFilepath, oshelper.NewOsHelper(), localdriver.Config{
+				Pools:             []localdriver.Pool{{Name: localdriver.DefaultPoolName, Path: mountDir}},
+				Leases:            leases,
+				IdempotencyWindow: time.Minute,
+				Clock:             fakeClock,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			createSuccessful(env, localDriver, volumeId)
+		})
+
+		mountWithLease := func(env dockerdriver.Env, lease interface{}) dockerdriver.MountResponse {
+			return localDriver.Mount(env, dockerdriver.MountRequest{
+				Name: volumeId,
+				Opts: map[string]interface{}{localdriver.LeaseOption: lease},
+			})
+		}
+
+		It("requires the ID of the mounting container", func() {
+			Expect(mountWithLease(env, "30s").Err).To(Equal("The 'lease' option requires the ID of the mounting container"))
+		})
+
+		It("rejects an invalid lease", func() {
+			Expect(mountWithLease(holderEnv, "soon").Err).To(ContainSubstring("Invalid 'lease' option"))
+		})
+
+		Context("when leases are not enabled", func() {
+			BeforeEach(func() {
+				leases = false
+			})
+
+			It("refuses a mount with a lease, which would never be renewed or released", func() {
+				Expect(mountWithLease(holderEnv, "30s").Err).To(Equal("The 'lease' option is not enabled on this driver"))
+				Expect(getSuccessful(env, localDriver, volumeId).Volume.Mountpoint).To(BeEmpty())
+			})
+		})
+
+		Context("when a holder mounts with a lease", func() {
+			JustBeforeEach(func() {
+				Expect(mountWithLease(holderEnv, "30s").Err).To(Equal(""))
+			})
+
+			It("reports when the lease runs out", func() {
+				getResponse := getSuccessful(env, localDriver, volumeId)
+				Expect(getResponse.Volume.Status["lease_expires_at"]).To(Equal(map[string]string{"container-1": "2020-01-01T00:00:30Z"}))
+			})
+
+			It("keeps the mount while the lease is renewed", func() {
+				fakeClock.Increment(20 * time.Second)
+				Expect(localDriver.Heartbeat(env, localdriver.HeartbeatRequest{Name: volumeId, Holder: "container-1"}).Err).To(Equal(""))
+				fakeClock.Increment(20 * time.Second)
+
+				response := localDriver.ReapExpired(env)
+				Expect(response.Released).To(BeEmpty())
+				Expect(state[volumeId].MountCount).To(Equal(1))
+			})
+
+			It("releases the mount once the lease has run out", func() {
+				fakeClock.Increment(30 * time.Second)
+
+				response := localDriver.ReapExpired(env)
+				Expect(response.Err).To(Equal(""))
+				Expect(response.Released).To(ConsistOf(localdriver.ReleasedLease{Volume: volumeId, Holder: "container-1"}))
+				Expect(state[volumeId].MountCount).To(Equal(0))
+				Expect(state[volumeId].Mountpoint).To(BeEmpty())
+				Expect(testOs.RemoveArgsForCall(0)).To(Equal(filepath.Join(mountDir, "_mounts", volumeId, "container-1")))
+				Expect(testLogger.(*lagertest.TestLogger).LogMessages()).To(ContainElement("localdriver-local.reap-expired.lease-expired"))
+			})
+
+			It("mounts the volume again when the released mount is retried", func() {
+				fakeClock.Increment(30 * time.Second)
+				Expect(localDriver.ReapExpired(env).Released).To(HaveLen(1))
+
+				Expect(mountWithLease(holderEnv, "30s").Err).To(Equal(""))
+				Expect(state[volumeId].MountCount).To(Equal(1))
+				Expect(testOs.SymlinkCallCount()).To(Equal(2))
+				_, mountPath := testOs.SymlinkArgsForCall(1)
+				Expect(mountPath).To(Equal(filepath.Join(mountDir, "_mounts", volumeId, "container-1")))
+			})
+
+			It("keeps the volume mounted for holders without a lease", func() {
+				otherEnv := driverhttp.NewHttpDriverEnv(testLogger, localdriver.WithRequestID(ctx, "container-2"))
+				mountSuccessful(otherEnv, localDriver, volumeId)
+				fakeClock.Increment(time.Minute)
+
+				localDriver.ReapExpired(env)
+				Expect(state[volumeId].MountCount).To(Equal(1))
+				Expect(state[volumeId].Holders).To(HaveKey("container-2"))
+				Expect(state[volumeId].Mountpoint).To(Equal(filepath.Join(mountDir, "_mounts", volumeId, "container-2")))
+			})
+
+			It("refuses a heartbeat from a caller that does not hold the volume", func() {
+				response := localDriver.Heartbeat(env, localdriver.HeartbeatRequest{Name: volumeId, Holder: "container-2"})
+				Expect(response.Err).To(Equal("Volume 'test-volume-id' is not mounted by 'container-2'"))
+			})
+		})
+
+		It("refuses a heartbeat for a mount without a lease", func() {
+			mountSuccessful(holderEnv, localDriver, volumeId)
+			response := localDriver.Heartbeat(env, localdriver.HeartbeatRequest{Name: volumeId, Holder: "container-1"})
+			Expect(response.Err).To(Equal("Volume 'test-volume-id' was mounted by 'container-1' without a lease"))
+		})
 	})
 
 	Describe("Get", func() {
@@ -475,6 +2330,171 @@ func getSuccessful(env dockerdriver.Env, localDriver dockerdriver.Driver, volume
 	return getResponse
 }
 
+// blockingOs holds up the first file created until release is closed, and
+// closes started once it does.
+type blockingOs struct {
+	osshim.OsShim
+	once    sync.Once
+	started chan struct{}
+	release chan struct{}
+}
+
+func (o *blockingOs) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	if flag&os.O_CREATE != 0 {
+		o.once.Do(func() {
+			close(o.started)
+			<-o.release
+		})
+	}
+	return o.OsShim.OpenFile(name, flag, perm)
+}
+
+// unprivilegedOs fails to change the owner of files like a driver that does
+// not run as root.
+type unprivilegedOs struct {
+	osshim.OsShim
+}
+
+func (o *unprivilegedOs) Chown(name string, uid, gid int) error {
+	return &os.PathError{Op: "chown", Path: name, Err: syscall.EPERM}
+}
+
+func (o *unprivilegedOs) Lchown(name string, uid, gid int) error {
+	return &os.PathError{Op: "lchown", Path: name, Err: syscall.EPERM}
+}
+
+// layerOsHelper records overlay mounts instead of performing them.
+type layerOsHelper struct {
+	localdriver.OsHelper
+	overlayErr error
+	overlays   []string
+	unmounted  []string
+}
+
+func (h *layerOsHelper) MountOverlay(lower, upper, work, target string) error {
+	if h.overlayErr != nil {
+		return h.overlayErr
+	}
+	h.overlays = append(h.overlays, lower, upper, work, target)
+	return nil
+}
+
+func (h *layerOsHelper) Unmount(target string) error {
+	h.unmounted = append(h.unmounted, target)
+	return nil
+}
+
+// memoryOsHelper records tmpfs mounts instead of performing them.
+type memoryOsHelper struct {
+	localdriver.OsHelper
+	tmpfsErr   error
+	tmpfs      map[string]uint64
+	resizeErr  error
+	unmountErr error
+	unmounted  []string
+	free       uint64
+}
+
+func (h *memoryOsHelper) MountTmpfs(target string, size uint64) error {
+	if h.tmpfsErr != nil {
+		return h.tmpfsErr
+	}
+	h.tmpfs[target] = size
+	return nil
+}
+
+func (h *memoryOsHelper) ResizeTmpfs(target string, size uint64) error {
+	if h.resizeErr != nil {
+		return h.resizeErr
+	}
+	h.tmpfs[target] = size
+	return nil
+}
+
+func (h *memoryOsHelper) Unmount(target string) error {
+	if h.unmountErr != nil {
+		return h.unmountErr
+	}
+	h.unmounted = append(h.unmounted, target)
+	return nil
+}
+
+func (h *memoryOsHelper) Statfs(path string) (localdriver.FilesystemStats, error) {
+	if h.free > 0 {
+		return localdriver.FilesystemStats{FreeBytes: h.free}, nil
+	}
+	return h.OsHelper.Statfs(path)
+}
+
+// imageOsHelper records image operations instead of performing them.
+type imageOsHelper struct {
+	localdriver.OsHelper
+	images     map[string]uint64
+	resized    map[string]uint64
+	mountErr   error
+	resizeErr  error
+	unmountErr error
+	mounted    []string
+	unmounted  []string
+}
+
+func (h *imageOsHelper) CreateImage(image string, size uint64) error {
+	if h.images == nil {
+		h.images = map[string]uint64{}
+	}
+	h.images[image] = size
+	return os.WriteFile(image, nil, 0600)
+}
+
+func (h *imageOsHelper) MountImage(image, target string) error {
+	if h.mountErr != nil {
+		return h.mountErr
+	}
+	h.mounted = append(h.mounted, target)
+	return nil
+}
+
+func (h *imageOsHelper) ResizeImage(image string, size uint64) error {
+	if h.resizeErr != nil {
+		return h.resizeErr
+	}
+	if h.resized == nil {
+		h.resized = map[string]uint64{}
+	}
+	h.resized[image] = size
+	return nil
+}
+
+func (h *imageOsHelper) Unmount(target string) error {
+	if h.unmountErr != nil {
+		return h.unmountErr
+	}
+	h.unmounted = append(h.unmounted, target)
+	return nil
+}
+
+// capacityOsHelper reports made up statfs results for some paths.
+type capacityOsHelper struct {
+	localdriver.OsHelper
+	stats  map[string]localdriver.FilesystemStats
+	errs   map[string]error
+	statfs map[string]int
+}
+
+func (h *capacityOsHelper) Statfs(path string) (localdriver.FilesystemStats, error) {
+	if h.statfs == nil {
+		h.statfs = map[string]int{}
+	}
+	h.statfs[path]++
+	if err, ok := h.errs[path]; ok {
+		return localdriver.FilesystemStats{}, err
+	}
+	if stats, ok := h.stats[path]; ok {
+		return stats, nil
+	}
+	return h.OsHelper.Statfs(path)
+}
+
 func createSuccessful(env dockerdriver.Env, localDriver dockerdriver.Driver, volumeName string) {
 	createResponse := localDriver.Create(env, dockerdriver.CreateRequest{
 		Name: volumeName,
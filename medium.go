@@ -0,0 +1,160 @@
+package localdriver
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"code.cloudfoundry.org/bytefmt"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// MediumOption is the Create option that chooses what backs a volume.
+const MediumOption = "medium"
+
+// MediumMemory keeps the volume in memory, so that its data never reaches the
+// disk and is gone after Remove or a reboot.
+const MediumMemory = "memory"
+
+// SizeOption is the Create option that caps the size of a volume.
+const SizeOption = "size"
+
+const (
+	// MemoryTmpfs is a tmpfs mounted on the volume directory.
+	MemoryTmpfs = "tmpfs"
+	// MemoryShared is a directory in the shared memory directory, used where
+	// tmpfs cannot be mounted.
+	MemoryShared = "shm"
+)
+
+// DefaultSharedMemoryDir is where memory volumes are kept when tmpfs cannot be
+// mounted.
+const DefaultSharedMemoryDir = "/dev/shm"
+
+// DefaultMaxMemoryVolumeSize is the size of memory volumes created without a
+// 'size' option, and the largest size they may ask for.
+const DefaultMaxMemoryVolumeSize uint64 = 64 * bytefmt.MEGABYTE
+
+func mediumFromOpts(opts map[string]interface{}) (string, error) {
+	switch value := opts[MediumOption]; value {
+	case nil, "disk":
+		return "", nil
+	case MediumMemory:
+		return MediumMemory, nil
+	default:
+		return "", fmt.Errorf("Invalid 'medium' option: %v", value)
+	}
+}
+
+// sizeFromOpts reads the 'size' option, a number of bytes or a string such as
+// "512M", returning 0 when the option is missing.
+func sizeFromOpts(opts map[string]interface{}) (uint64, error) {
+	switch value := opts[SizeOption].(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		if value != math.Trunc(value) || value < 1 || value > math.MaxInt64 {
+			return 0, fmt.Errorf("Invalid 'size' option: %v", value)
+		}
+		return uint64(value), nil
+	case int:
+		if value < 1 {
+			return 0, fmt.Errorf("Invalid 'size' option: %v", value)
+		}
+		return uint64(value), nil
+	case string:
+		size, err := bytefmt.ToBytes(value)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid 'size' option: %s", value)
+		}
+		return size, nil
+	default:
+		return 0, fmt.Errorf("Invalid 'size' option: %v", value)
+	}
+}
+
+// memorySize checks the size asked for a memory volume against the driver's
+// limit, which is also the size of volumes that do not ask.
+func (d *LocalDriver) memorySize(size uint64) (uint64, error) {
+	if size == 0 {
+		return d.maxMemoryVolumeSize, nil
+	}
+	if size > d.maxMemoryVolumeSize {
+		return 0, fmt.Errorf("Invalid 'size' option: memory volumes are limited to %s", bytefmt.ByteSize(d.maxMemoryVolumeSize))
+	}
+	return size, nil
+}
+
+// createMemoryVolume mounts a tmpfs of vol.Size on volumePath. Where that is
+// not allowed it creates the volume in the shared memory directory instead and
+// links volumePath to it; the size is then only checked against the free
+// memory at creation, so a volume whose size was asked for is refused.
+func (d *LocalDriver) createMemoryVolume(logger lager.Logger, vol *LocalVolumeInfo, volumePath string, mode os.FileMode, sizeAsked bool) error {
+	logger = logger.Session("create-memory-volume", lager.Data{"volume": volumePath, "size": vol.Size})
+
+	if err := d.mkdirAll(volumePath, mode); err != nil {
+		return err
+	}
+	err := d.osHelper.MountTmpfs(volumePath, vol.Size)
+	if err == nil {
+		logger.Info("mounted-tmpfs")
+		return nil
+	}
+	if sizeAsked {
+		d.os.Remove(volumePath)
+		return fmt.Errorf("the 'size' option cannot be enforced without tmpfs: %s", err)
+	}
+	logger.Info("tmpfs-unavailable-using-shared-memory", lager.Data{"reason": err.Error()})
+
+	if err := d.os.Remove(volumePath); err != nil {
+		return err
+	}
+
+	stats, err := d.osHelper.Statfs(d.sharedMemoryDir)
+	if err != nil {
+		return err
+	}
+	if stats.FreeBytes < vol.Size {
+		return fmt.Errorf("%s has %s free, less than the %s asked for", d.sharedMemoryDir, bytefmt.ByteSize(stats.FreeBytes), bytefmt.ByteSize(vol.Size))
+	}
+
+	memoryDir := d.filepath.Join(d.sharedMemoryDir, "localdriver", d.filepath.Base(volumePath))
+	if err := d.mkdirAll(d.filepath.Dir(memoryDir), os.ModePerm); err != nil {
+		return err
+	}
+	if err := d.os.Mkdir(memoryDir, mode); err != nil {
+		return err
+	}
+	if err := d.os.Symlink(memoryDir, volumePath); err != nil {
+		d.os.RemoveAll(memoryDir)
+		return err
+	}
+	vol.MemoryDir = memoryDir
+	return nil
+}
+
+// removeMemoryVolume drops the data of a memory volume along with its
+// volume directory.
+func (d *LocalDriver) removeMemoryVolume(logger lager.Logger, vol *LocalVolumeInfo, volumePath string) error {
+	if vol.MemoryDir != "" {
+		logger.Info("remove-shared-memory-folder", lager.Data{"path": vol.MemoryDir})
+		if err := d.os.RemoveAll(vol.MemoryDir); err != nil {
+			return err
+		}
+		return d.os.RemoveAll(volumePath)
+	}
+
+	logger.Info("unmount-tmpfs", lager.Data{"volume": volumePath})
+	if err := d.osHelper.Unmount(volumePath); err != nil {
+		return err
+	}
+	return d.os.RemoveAll(volumePath)
+}
+
+// memoryBacking tells how a memory volume is kept in memory.
+func (vol *LocalVolumeInfo) memoryBacking() string {
+	if vol.MemoryDir != "" {
+		return MemoryShared
+	}
+	return MemoryTmpfs
+}
@@ -0,0 +1,142 @@
+package localdriver
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+type MoveRequest struct {
+	Name string
+	Pool string
+}
+
+// Move relocates an unmounted volume to another pool. The data is copied and
+// verified before the volume is switched over, so a failed move leaves the
+// volume where it was. The copy runs without holding the driver lock; the
+// volume cannot be mounted, resized, removed or moved again meanwhile.
+func (d *LocalDriver) Move(env dockerdriver.Env, moveRequest MoveRequest) dockerdriver.ErrorResponse {
+	logger := env.Logger().Session("move", lager.Data{"volume": moveRequest.Name, "pool": moveRequest.Pool})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	move, response := d.startMove(logger, moveRequest)
+	if response.Err != "" {
+		return response
+	}
+
+	logger.Info("copying-volume", lager.Data{"src": move.sourcePath, "tgt": move.targetPath})
+	err := d.copyTree(move.sourcePath, move.targetPath, false)
+	if err == nil {
+		err = d.verifyTree(move.sourcePath, move.targetPath)
+	}
+	if err != nil {
+		logger.Error("failed-copying-volume", err)
+		if cleanupErr := d.os.RemoveAll(move.targetPath); cleanupErr != nil {
+			logger.Error("failed-removing-partial-copy", cleanupErr, lager.Data{"path": move.targetPath})
+		}
+		d.finishMove(move, false)
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Failed moving volume: %s", err)}
+	}
+
+	d.finishMove(move, true)
+	logger.Info("volume-moved", lager.Data{"from": move.source.Name, "to": move.target.Name})
+
+	err = d.os.RemoveAll(move.sourcePath)
+	if err != nil {
+		logger.Error("failed-removing-source", err, lager.Data{"path": move.sourcePath})
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume moved but failed removing source: %s", err)}
+	}
+
+	return dockerdriver.ErrorResponse{}
+}
+
+type volumeMove struct {
+	vol        *LocalVolumeInfo
+	source     *Pool
+	target     *Pool
+	sourcePath string
+	targetPath string
+}
+
+// startMove checks that the volume can be moved to the requested pool and
+// marks it as moving.
+func (d *LocalDriver) startMove(logger lager.Logger, moveRequest MoveRequest) (*volumeMove, dockerdriver.ErrorResponse) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if moveRequest.Name == "" {
+		return nil, dockerdriver.ErrorResponse{Err: "Missing mandatory 'volume_name'"}
+	}
+	if moveRequest.Pool == "" {
+		return nil, dockerdriver.ErrorResponse{Err: "Missing mandatory 'pool'"}
+	}
+
+	vol, ok := d.volumes[moveRequest.Name]
+	if !ok {
+		return nil, dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' not found", moveRequest.Name)}
+	}
+
+	if vol.moving {
+		return nil, dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' is being moved", moveRequest.Name)}
+	}
+
+	if vol.MountCount > 0 || vol.Mountpoint != "" || vol.ImageMounted || len(vol.layerCopies) > 0 {
+		return nil, dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' is mounted and cannot be moved", moveRequest.Name)}
+	}
+
+	if vol.Medium == MediumMemory {
+		return nil, dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' is kept in memory and cannot be moved", moveRequest.Name)}
+	}
+
+	target, ok := d.pool(moveRequest.Pool)
+	if !ok {
+		return nil, dockerdriver.ErrorResponse{Err: fmt.Sprintf("Pool '%s' not found", moveRequest.Pool)}
+	}
+
+	source := d.volumePool(vol)
+	if source.Name == target.Name {
+		return nil, dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' is already in pool '%s'", vol.Name, target.Name)}
+	}
+
+	sourcePath := d.volumePath(logger, source.Path, vol.Name)
+	targetPath := d.volumePath(logger, target.Path, vol.Name)
+
+	exists, err := d.exists(targetPath)
+	if err != nil {
+		logger.Error("failed-checking-target", err, lager.Data{"path": targetPath})
+		return nil, dockerdriver.ErrorResponse{Err: err.Error()}
+	}
+	if exists {
+		return nil, dockerdriver.ErrorResponse{Err: fmt.Sprintf("Path '%s' already exists in pool '%s'", targetPath, target.Name)}
+	}
+
+	size, err := d.diskUsage(sourcePath)
+	if err != nil {
+		logger.Error("failed-computing-volume-size", err, lager.Data{"path": sourcePath})
+		return nil, dockerdriver.ErrorResponse{Err: err.Error()}
+	}
+	if free := d.poolFree(logger, target); free < size {
+		return nil, dockerdriver.ErrorResponse{Err: fmt.Sprintf("Pool '%s' does not have room for volume '%s'", target.Name, vol.Name)}
+	}
+
+	logger.Info("moving-volume", lager.Data{"bytes": size})
+	vol.moving = true
+	return &volumeMove{vol: vol, source: source, target: target, sourcePath: sourcePath, targetPath: targetPath}, dockerdriver.ErrorResponse{}
+}
+
+// finishMove switches the volume over to the target pool when the copy
+// succeeded, and lets the volume be used again.
+func (d *LocalDriver) finishMove(move *volumeMove, copied bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	move.vol.moving = false
+	if !copied {
+		return
+	}
+	move.vol.Pool = move.target.Name
+	d.forgetPoolUsage(move.source)
+	d.forgetPoolUsage(move.target)
+}
@@ -0,0 +1,20 @@
+//go:build darwin
+// +build darwin
+
+package oshelper
+
+import "errors"
+
+var errNoImages = errors.New("image-backed volumes are not available on darwin")
+
+func (o *osHelper) CreateImage(image string, size uint64) error {
+	return errNoImages
+}
+
+func (o *osHelper) MountImage(image, target string) error {
+	return errNoImages
+}
+
+func (o *osHelper) ResizeImage(image string, size uint64) error {
+	return errNoImages
+}
@@ -0,0 +1,89 @@
+//go:build linux
+// +build linux
+
+package oshelper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CreateImage creates a sparse file of size bytes at image and formats it
+// with ext4.
+func (o *osHelper) CreateImage(image string, size uint64) error {
+	file, err := os.OpenFile(image, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	err = file.Truncate(int64(size))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return run("mkfs.ext4", "-q", "-F", image)
+}
+
+func (o *osHelper) MountImage(image, target string) error {
+	if _, err := os.Stat("/dev/loop-control"); err != nil {
+		return fmt.Errorf("loop devices are not available: %s", err)
+	}
+	return run("mount", "-o", "loop", image, target)
+}
+
+// ResizeImage changes the size of image and of its filesystem. A mounted
+// image is grown in place through its loop device; an unmounted one is
+// checked first, since resize2fs insists on that, and may also shrink.
+func (o *osHelper) ResizeImage(image string, size uint64) error {
+	devices, err := exec.Command("losetup", "--noheadings", "--output", "NAME", "--associated", image).Output()
+	if err != nil {
+		return fmt.Errorf("losetup: %s", err)
+	}
+	if fields := strings.Fields(string(devices)); len(fields) > 0 {
+		if err := os.Truncate(image, int64(size)); err != nil {
+			return err
+		}
+		if err := run("losetup", "--set-capacity", fields[0]); err != nil {
+			return err
+		}
+		return run("resize2fs", fields[0])
+	}
+
+	info, err := os.Stat(image)
+	if err != nil {
+		return err
+	}
+	if err := run("e2fsck", "-f", "-p", image); err != nil {
+		return err
+	}
+	if size > uint64(info.Size()) {
+		if err := os.Truncate(image, int64(size)); err != nil {
+			return err
+		}
+		return run("resize2fs", image)
+	}
+
+	// shrink the filesystem before the file it lives in
+	if err := run("resize2fs", image, fmt.Sprintf("%dK", size/1024)); err != nil {
+		return err
+	}
+	return os.Truncate(image, int64(size))
+}
+
+func run(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	var exitErr *exec.ExitError
+	if name == "e2fsck" && errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// e2fsck exits with 1 when it corrected errors
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -16,6 +16,16 @@ func NewOsHelper() localdriver.OsHelper {
 	return &osHelper{}
 }
 
-func (o *osHelper) Umask(mask int) (oldmask int) {
-	return syscall.Umask(mask)
+func (o *osHelper) Statfs(path string) (localdriver.FilesystemStats, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return localdriver.FilesystemStats{}, err
+	}
+
+	return localdriver.FilesystemStats{
+		TotalBytes:  uint64(stat.Blocks) * uint64(stat.Bsize),
+		FreeBytes:   uint64(stat.Bavail) * uint64(stat.Bsize),
+		TotalInodes: uint64(stat.Files),
+		FreeInodes:  uint64(stat.Ffree),
+	}, nil
 }
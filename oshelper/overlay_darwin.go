@@ -0,0 +1,14 @@
+//go:build darwin
+// +build darwin
+
+package oshelper
+
+import "errors"
+
+func (o *osHelper) MountOverlay(lower, upper, work, target string) error {
+	return errors.New("overlayfs is not available on darwin")
+}
+
+func (o *osHelper) Unmount(target string) error {
+	return errors.New("overlayfs is not available on darwin")
+}
@@ -0,0 +1,26 @@
+//go:build linux
+// +build linux
+
+package oshelper
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+func (o *osHelper) MountOverlay(lower, upper, work, target string) error {
+	// the overlay options are separated by commas and colons
+	for _, dir := range []string{lower, upper, work} {
+		if strings.ContainsAny(dir, ",:") {
+			return fmt.Errorf("cannot pass %s to overlayfs", dir)
+		}
+	}
+
+	options := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", lower, upper, work)
+	return syscall.Mount("overlay", target, "overlay", 0, options)
+}
+
+func (o *osHelper) Unmount(target string) error {
+	return syscall.Unmount(target, 0)
+}
@@ -0,0 +1,14 @@
+//go:build darwin
+// +build darwin
+
+package oshelper
+
+import "errors"
+
+func (o *osHelper) MountTmpfs(target string, size uint64) error {
+	return errors.New("tmpfs is not available on darwin")
+}
+
+func (o *osHelper) ResizeTmpfs(target string, size uint64) error {
+	return errors.New("tmpfs is not available on darwin")
+}
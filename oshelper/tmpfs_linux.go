@@ -0,0 +1,17 @@
+//go:build linux
+// +build linux
+
+package oshelper
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func (o *osHelper) MountTmpfs(target string, size uint64) error {
+	return syscall.Mount("tmpfs", target, "tmpfs", syscall.MS_NODEV|syscall.MS_NOSUID, fmt.Sprintf("size=%d", size))
+}
+
+func (o *osHelper) ResizeTmpfs(target string, size uint64) error {
+	return syscall.Mount("tmpfs", target, "tmpfs", syscall.MS_REMOUNT|syscall.MS_NODEV|syscall.MS_NOSUID, fmt.Sprintf("size=%d", size))
+}
@@ -0,0 +1,111 @@
+package localdriver
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+)
+
+// DefaultVolumeMode is the mode of a volume root created without a 'mode'
+// option: writable by its owner only.
+const DefaultVolumeMode os.FileMode = 0755
+
+// ownership is what the 'uid', 'gid' and 'mode' create options ask for. A
+// negative uid or gid leaves it as the driver created it.
+type ownership struct {
+	uid  int
+	gid  int
+	mode os.FileMode
+}
+
+func ownershipFromOpts(opts map[string]interface{}) (ownership, error) {
+	uid, err := idFromOpts(opts, "uid")
+	if err != nil {
+		return ownership{}, err
+	}
+	gid, err := idFromOpts(opts, "gid")
+	if err != nil {
+		return ownership{}, err
+	}
+	mode, err := modeFromOpts(opts)
+	if err != nil {
+		return ownership{}, err
+	}
+	return ownership{uid: uid, gid: gid, mode: mode}, nil
+}
+
+// idFromOpts reads a user or group ID given as a number or a numeric
+// string, returning -1 when the option is missing.
+func idFromOpts(opts map[string]interface{}, name string) (int, error) {
+	var id int64
+	switch value := opts[name].(type) {
+	case nil:
+		return -1, nil
+	case float64:
+		if value != math.Trunc(value) || value < 0 || value > math.MaxInt32 {
+			return 0, fmt.Errorf("Invalid '%s' option: %v", name, value)
+		}
+		id = int64(value)
+	case int:
+		id = int64(value)
+	case string:
+		var err error
+		id, err = strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid '%s' option: %s", name, value)
+		}
+	default:
+		return 0, fmt.Errorf("Invalid '%s' option: %v", name, value)
+	}
+
+	if id < 0 {
+		return 0, fmt.Errorf("Invalid '%s' option: must not be negative", name)
+	}
+	return int(id), nil
+}
+
+// modeFromOpts reads the 'mode' option, an octal string such as "0750".
+// Numbers are refused, since 750 would be read as decimal, and so is "0000",
+// since a zero mode stands for a volume created without one.
+func modeFromOpts(opts map[string]interface{}) (os.FileMode, error) {
+	raw, ok := opts["mode"]
+	if !ok || raw == nil {
+		return DefaultVolumeMode, nil
+	}
+
+	value, ok := raw.(string)
+	if !ok {
+		return 0, fmt.Errorf("Invalid 'mode' option: %v must be an octal string such as \"0750\"", raw)
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("Invalid 'mode' option: %s must be an octal mode such as \"0750\"", value)
+	}
+	if mode == 0 {
+		return 0, fmt.Errorf("Invalid 'mode' option: %s leaves the volume inaccessible", value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// applyOwnership sets the mode and, where asked for, the owner of a volume
+// root, and records the result in vol.
+func (d *LocalDriver) applyOwnership(vol *LocalVolumeInfo, path string, owner ownership) error {
+	if owner.uid >= 0 || owner.gid >= 0 {
+		if err := d.os.Chown(path, owner.uid, owner.gid); err != nil {
+			return err
+		}
+	}
+	if err := d.os.Chmod(path, owner.mode); err != nil {
+		return err
+	}
+
+	vol.UID, vol.GID, vol.Mode = owner.uid, owner.gid, owner.mode
+	if owner.uid < 0 {
+		vol.UID = d.os.Getuid()
+	}
+	if owner.gid < 0 {
+		vol.GID = d.os.Getgid()
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package localdriver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const DefaultPoolName = "default"
+
+// PoolUsageMaxAge is how long the space used by the volumes in a pool is
+// remembered before it is measured again.
+const PoolUsageMaxAge = 30 * time.Second
+
+type PlacementPolicy string
+
+const (
+	PlacementFirst         PlacementPolicy = ""
+	PlacementMostFreeSpace PlacementPolicy = "most-free-space"
+	PlacementRoundRobin    PlacementPolicy = "round-robin"
+)
+
+// Pool is a named mount root. Capacity is the number of bytes the volumes in
+// the pool may use between them; zero means the pool is only limited by the
+// filesystem it lives on.
+type Pool struct {
+	Name     string
+	Path     string
+	Capacity uint64
+}
+
+type poolUsage struct {
+	bytes      uint64
+	measuredAt time.Time
+}
+
+func ValidPlacementPolicy(policy PlacementPolicy) bool {
+	switch policy {
+	case PlacementFirst, PlacementMostFreeSpace, PlacementRoundRobin:
+		return true
+	}
+	return false
+}
+
+// validatePools fails unless there is at least one pool, every pool has a
+// name, no two pools share a name and the placement policy is known.
+func validatePools(pools []Pool, placement PlacementPolicy) error {
+	if len(pools) == 0 {
+		return fmt.Errorf("no pools configured")
+	}
+	names := map[string]bool{}
+	for _, pool := range pools {
+		if pool.Name == "" {
+			return fmt.Errorf("pool at '%s' has no name", pool.Path)
+		}
+		if names[pool.Name] {
+			return fmt.Errorf("duplicate pool name '%s'", pool.Name)
+		}
+		names[pool.Name] = true
+	}
+	if !ValidPlacementPolicy(placement) {
+		return fmt.Errorf("invalid placement policy '%s'", placement)
+	}
+	return nil
+}
+
+func (d *LocalDriver) pool(name string) (*Pool, bool) {
+	if name == "" {
+		return &d.pools[0], true
+	}
+	for i := range d.pools {
+		if d.pools[i].Name == name {
+			return &d.pools[i], true
+		}
+	}
+	return nil, false
+}
+
+func (d *LocalDriver) volumePool(vol *LocalVolumeInfo) *Pool {
+	if pool, ok := d.pool(vol.Pool); ok {
+		return pool
+	}
+	return &d.pools[0]
+}
+
+func (d *LocalDriver) placeVolume(logger lager.Logger, opts map[string]interface{}) (*Pool, error) {
+	if requested, ok := opts["pool"]; ok {
+		name, ok := requested.(string)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("Invalid 'pool' option: %v", requested)
+		}
+		pool, ok := d.pool(name)
+		if !ok {
+			return nil, fmt.Errorf("Pool '%s' not found", name)
+		}
+		if d.poolFree(logger, pool) == 0 {
+			return nil, fmt.Errorf("Pool '%s' is full", name)
+		}
+		if err := d.checkFreeThresholds(pool); err != nil {
+			return nil, err
+		}
+		return pool, nil
+	}
+
+	// pools below the free space thresholds are skipped like full ones
+	var thresholdErr error
+	room := func(pool *Pool) uint64 {
+		if err := d.checkFreeThresholds(pool); err != nil {
+			logger.Info("skipping-pool", lager.Data{"pool": pool.Name, "reason": err.Error()})
+			if thresholdErr == nil {
+				thresholdErr = err
+			}
+			return 0
+		}
+		return d.poolFree(logger, pool)
+	}
+
+	switch d.placement {
+	case PlacementRoundRobin:
+		for range d.pools {
+			pool := &d.pools[d.nextPool%len(d.pools)]
+			d.nextPool++
+			if room(pool) > 0 {
+				return pool, nil
+			}
+		}
+	case PlacementMostFreeSpace:
+		var best *Pool
+		var bestFree uint64
+		for i := range d.pools {
+			free := room(&d.pools[i])
+			if free > bestFree {
+				best, bestFree = &d.pools[i], free
+			}
+		}
+		if best != nil {
+			return best, nil
+		}
+	default:
+		for i := range d.pools {
+			if room(&d.pools[i]) > 0 {
+				return &d.pools[i], nil
+			}
+		}
+	}
+
+	if thresholdErr != nil {
+		return nil, thresholdErr
+	}
+	return nil, fmt.Errorf("All pools are full")
+}
+
+// poolFree returns the number of bytes still available to volumes in the
+// pool. Errors are logged and treated as an empty pool so that placement
+// skips it.
+func (d *LocalDriver) poolFree(logger lager.Logger, pool *Pool) uint64 {
+	stats, err := d.poolStats(pool)
+	if err != nil {
+		logger.Error("failed-statfs-pool", err, lager.Data{"pool": pool.Name, "path": pool.Path})
+		return 0
+	}
+	free := stats.FreeBytes
+
+	if pool.Capacity == 0 {
+		return free
+	}
+
+	used, err := d.poolUsage(pool)
+	if err != nil {
+		logger.Error("failed-computing-pool-usage", err, lager.Data{"pool": pool.Name, "path": pool.Path})
+		return 0
+	}
+	if used >= pool.Capacity {
+		return 0
+	}
+	if remaining := pool.Capacity - used; remaining < free {
+		return remaining
+	}
+	return free
+}
+
+// poolUsage is the number of bytes the volumes in the pool use. Measuring it
+// walks every file in the pool, so a measurement is reused until it is
+// PoolUsageMaxAge old.
+func (d *LocalDriver) poolUsage(pool *Pool) (uint64, error) {
+	now := d.clock.Now()
+	if usage, ok := d.poolUsages[pool.Name]; ok && now.Sub(usage.measuredAt) < PoolUsageMaxAge {
+		return usage.bytes, nil
+	}
+
+	used, err := d.diskUsage(d.filepath.Join(pool.Path, VolumesRootDir))
+	if err != nil {
+		return 0, err
+	}
+	d.poolUsages[pool.Name] = poolUsage{bytes: used, measuredAt: now}
+	return used, nil
+}
+
+// forgetPoolUsage makes the next poolUsage measure the pool again.
+func (d *LocalDriver) forgetPoolUsage(pool *Pool) {
+	delete(d.poolUsages, pool.Name)
+}
+
+// diskUsage sums the space allocated to the regular files below root. Mounts
+// below root, such as tmpfs memory volumes and mounted images, are on other
+// filesystems and are not counted.
+func (d *LocalDriver) diskUsage(root string) (uint64, error) {
+	if _, err := d.os.Stat(root); os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	var used uint64
+	var rootDevice uint64
+	err := d.filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		allocated, device, ok := fileUsage(info)
+		if path == root {
+			rootDevice = device
+		} else if ok && device != rootDevice {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			used += allocated
+		}
+		return nil
+	})
+	return used, err
+}
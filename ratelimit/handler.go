@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// operationRoutes are the volume plugin routes that touch the filesystem and
+// count towards MaxConcurrentOperations.
+var operationRoutes = map[string]bool{
+	"/VolumeDriver.Create":  true,
+	"/VolumeDriver.Remove":  true,
+	"/VolumeDriver.Mount":   true,
+	"/VolumeDriver.Unmount": true,
+}
+
+// NewHandler applies the limiter to the volume plugin requests before passing
+// them on to next. Requests over a rate limit are answered with 429, and
+// filesystem operations over the concurrency cap with 503, both with an
+// ErrorResponse explaining which limit was hit.
+func NewHandler(logger lager.Logger, limiter *Limiter, next http.Handler) http.Handler {
+	logger = logger.Session("rate-limit")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.URL.Path, "/VolumeDriver.") {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		client := clientID(req)
+		if err := limiter.allow(client); err != nil {
+			logger.Info("rejected", lager.Data{"client": client, "route": req.URL.Path, "reason": err.Error()})
+			writeErrorResponse(w, http.StatusTooManyRequests, err.Error())
+			return
+		}
+
+		if operationRoutes[req.URL.Path] {
+			done, err := limiter.startOperation()
+			if err != nil {
+				logger.Info("rejected", lager.Data{"client": client, "route": req.URL.Path, "reason": err.Error()})
+				writeErrorResponse(w, http.StatusServiceUnavailable, err.Error())
+				return
+			}
+			defer done()
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+func writeErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	body, _ := json.Marshal(dockerdriver.ErrorResponse{Err: message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
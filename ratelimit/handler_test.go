@@ -0,0 +1,172 @@
+package ratelimit_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/localdriver/ratelimit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rate limit Handler", func() {
+	var (
+		fakeClock *fakeclock.FakeClock
+		limiter   *ratelimit.Limiter
+		handler   http.Handler
+		release   chan struct{}
+		served    sync.WaitGroup
+	)
+
+	BeforeEach(func() {
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		limiter = ratelimit.NewLimiter(fakeClock, ratelimit.Limits{})
+		release = nil
+	})
+
+	JustBeforeEach(func() {
+		next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if release != nil && req.URL.Path == "/VolumeDriver.Create" {
+				<-release
+			}
+			json.NewEncoder(w).Encode(dockerdriver.ErrorResponse{})
+		})
+		handler = ratelimit.NewHandler(lagertest.NewTestLogger("ratelimit"), limiter, next)
+	})
+
+	request := func(route, client string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", route, nil)
+		req.RemoteAddr = client + ":12345"
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	errorResponse := func(recorder *httptest.ResponseRecorder) string {
+		var response dockerdriver.ErrorResponse
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+		return response.Err
+	}
+
+	It("allows everything by default", func() {
+		for i := 0; i < 100; i++ {
+			Expect(request("/VolumeDriver.Create", "10.0.0.1").Code).To(Equal(http.StatusOK))
+		}
+	})
+
+	Context("with a client rate", func() {
+		BeforeEach(func() {
+			Expect(limiter.SetLimits(ratelimit.Limits{ClientRate: 2})).To(Succeed())
+		})
+
+		It("rejects a client over its rate without affecting others", func() {
+			Expect(request("/VolumeDriver.Create", "10.0.0.1").Code).To(Equal(http.StatusOK))
+			Expect(request("/VolumeDriver.Create", "10.0.0.1").Code).To(Equal(http.StatusOK))
+
+			recorder := request("/VolumeDriver.Create", "10.0.0.1")
+			Expect(recorder.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(errorResponse(recorder)).To(Equal("rate limit exceeded: client 10.0.0.1 may make 2 requests per second"))
+
+			Expect(request("/VolumeDriver.Create", "10.0.0.2").Code).To(Equal(http.StatusOK))
+
+			fakeClock.Increment(time.Second)
+			Expect(request("/VolumeDriver.Create", "10.0.0.1").Code).To(Equal(http.StatusOK))
+
+			metrics := limiter.Metrics()
+			Expect(metrics.Allowed).To(Equal(uint64(4)))
+			Expect(metrics.RejectedClient).To(Equal(uint64(1)))
+			Expect(metrics.Clients).To(Equal(2))
+		})
+
+		It("applies new limits to existing clients", func() {
+			Expect(request("/VolumeDriver.Get", "10.0.0.1").Code).To(Equal(http.StatusOK))
+			Expect(request("/VolumeDriver.Get", "10.0.0.1").Code).To(Equal(http.StatusOK))
+			Expect(request("/VolumeDriver.Get", "10.0.0.1").Code).To(Equal(http.StatusTooManyRequests))
+
+			Expect(limiter.SetLimits(ratelimit.Limits{})).To(Succeed())
+			Expect(request("/VolumeDriver.Get", "10.0.0.1").Code).To(Equal(http.StatusOK))
+		})
+
+		It("forgets clients that have gone quiet", func() {
+			request("/VolumeDriver.Get", "10.0.0.1")
+			fakeClock.Increment(11 * time.Minute)
+			request("/VolumeDriver.Get", "10.0.0.2")
+
+			Expect(limiter.Metrics().Clients).To(Equal(1))
+		})
+
+		It("does not limit plugin activation", func() {
+			for i := 0; i < 10; i++ {
+				Expect(request("/Plugin.Activate", "10.0.0.1").Code).To(Equal(http.StatusOK))
+			}
+		})
+	})
+
+	Context("with a global rate", func() {
+		BeforeEach(func() {
+			Expect(limiter.SetLimits(ratelimit.Limits{GlobalRate: 1})).To(Succeed())
+		})
+
+		It("rejects requests over the rate from any client", func() {
+			Expect(request("/VolumeDriver.List", "10.0.0.1").Code).To(Equal(http.StatusOK))
+
+			recorder := request("/VolumeDriver.List", "10.0.0.2")
+			Expect(recorder.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(errorResponse(recorder)).To(Equal("rate limit exceeded: the driver accepts 1 requests per second"))
+			Expect(limiter.Metrics().RejectedGlobal).To(Equal(uint64(1)))
+		})
+	})
+
+	Context("with a global and a client rate", func() {
+		BeforeEach(func() {
+			Expect(limiter.SetLimits(ratelimit.Limits{GlobalRate: 4, ClientRate: 2})).To(Succeed())
+		})
+
+		It("does not let a noisy client starve a quiet one", func() {
+			for i := 0; i < 10; i++ {
+				request("/VolumeDriver.List", "10.0.0.1")
+			}
+
+			Expect(request("/VolumeDriver.List", "10.0.0.2").Code).To(Equal(http.StatusOK))
+			Expect(request("/VolumeDriver.List", "10.0.0.2").Code).To(Equal(http.StatusOK))
+
+			metrics := limiter.Metrics()
+			Expect(metrics.Allowed).To(Equal(uint64(4)))
+			Expect(metrics.RejectedClient).To(Equal(uint64(8)))
+			Expect(metrics.RejectedGlobal).To(BeZero())
+		})
+	})
+
+	Context("with a cap on concurrent operations", func() {
+		BeforeEach(func() {
+			Expect(limiter.SetLimits(ratelimit.Limits{MaxConcurrentOperations: 1})).To(Succeed())
+			release = make(chan struct{})
+		})
+
+		It("rejects filesystem operations over the cap", func() {
+			served.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer served.Done()
+				Expect(request("/VolumeDriver.Create", "10.0.0.1").Code).To(Equal(http.StatusOK))
+			}()
+			Eventually(func() int { return limiter.Metrics().OperationsInFlight }).Should(Equal(1))
+
+			recorder := request("/VolumeDriver.Create", "10.0.0.2")
+			Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(errorResponse(recorder)).To(Equal("too many concurrent operations: the driver runs at most 1 at once"))
+			Expect(request("/VolumeDriver.Get", "10.0.0.2").Code).To(Equal(http.StatusOK))
+
+			close(release)
+			served.Wait()
+			Expect(limiter.Metrics().OperationsInFlight).To(Equal(0))
+			Expect(request("/VolumeDriver.Remove", "10.0.0.2").Code).To(Equal(http.StatusOK))
+		})
+	})
+})
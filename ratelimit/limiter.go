@@ -0,0 +1,215 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"golang.org/x/time/rate"
+)
+
+// clientIdleTimeout is how long a client has to stay quiet before its
+// limiter is forgotten.
+const clientIdleTimeout = 10 * time.Minute
+
+// Limits configures the limiter. Rates are in requests per second; a zero
+// rate or a zero MaxConcurrentOperations means unlimited. A zero burst
+// defaults to one second's worth of requests.
+type Limits struct {
+	GlobalRate              float64 `json:"global_rate"`
+	GlobalBurst             int     `json:"global_burst"`
+	ClientRate              float64 `json:"client_rate"`
+	ClientBurst             int     `json:"client_burst"`
+	MaxConcurrentOperations int     `json:"max_concurrent_operations"`
+}
+
+func (l Limits) Validate() error {
+	switch {
+	case l.GlobalRate < 0:
+		return fmt.Errorf("global_rate must not be negative")
+	case l.GlobalBurst < 0:
+		return fmt.Errorf("global_burst must not be negative")
+	case l.ClientRate < 0:
+		return fmt.Errorf("client_rate must not be negative")
+	case l.ClientBurst < 0:
+		return fmt.Errorf("client_burst must not be negative")
+	case l.MaxConcurrentOperations < 0:
+		return fmt.Errorf("max_concurrent_operations must not be negative")
+	}
+	return nil
+}
+
+type Metrics struct {
+	Limits              Limits `json:"limits"`
+	Allowed             uint64 `json:"allowed"`
+	RejectedGlobal      uint64 `json:"rejected_global"`
+	RejectedClient      uint64 `json:"rejected_client"`
+	RejectedConcurrency uint64 `json:"rejected_concurrency"`
+	OperationsInFlight  int    `json:"operations_in_flight"`
+	Clients             int    `json:"clients"`
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter enforces a global and a per-client request rate, and caps the
+// number of filesystem operations running at once. Limits can be changed
+// while requests are being served.
+type Limiter struct {
+	clock clock.Clock
+
+	lock     sync.Mutex
+	limits   Limits
+	global   *rate.Limiter
+	clients  map[string]*clientLimiter
+	inFlight int
+	metrics  Metrics
+}
+
+// NewLimiter returns a limiter enforcing limits, which the caller is expected
+// to have validated; invalid limits leave the limiter unlimited.
+func NewLimiter(clock clock.Clock, limits Limits) *Limiter {
+	l := &Limiter{
+		clock:   clock,
+		global:  rate.NewLimiter(rate.Inf, 0),
+		clients: map[string]*clientLimiter{},
+	}
+	l.SetLimits(limits)
+	return l
+}
+
+func (l *Limiter) Limits() Limits {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.limits
+}
+
+// SetLimits replaces the limits. Existing clients keep the tokens they have
+// left, capped at the new burst.
+func (l *Limiter) SetLimits(limits Limits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.clock.Now()
+	l.limits = limits
+	l.global = updateLimiter(l.global, now, limits.GlobalRate, limits.GlobalBurst)
+	for _, client := range l.clients {
+		client.limiter = updateLimiter(client.limiter, now, limits.ClientRate, limits.ClientBurst)
+	}
+	return nil
+}
+
+func (l *Limiter) Metrics() Metrics {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	metrics := l.metrics
+	metrics.Limits = l.limits
+	metrics.OperationsInFlight = l.inFlight
+	metrics.Clients = len(l.clients)
+	return metrics
+}
+
+// allow takes a token for client from the global and the client bucket, and
+// returns an error describing the limit that was hit otherwise. The global
+// token is given back when the client bucket is empty, so that a client over
+// its own rate does not use up the rate of the others.
+func (l *Limiter) allow(client string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.clock.Now()
+	l.forgetIdleClients(now)
+
+	global := l.global.ReserveN(now, 1)
+	if !global.OK() || global.DelayFrom(now) > 0 {
+		global.CancelAt(now)
+		l.metrics.RejectedGlobal++
+		return fmt.Errorf("rate limit exceeded: the driver accepts %g requests per second", l.limits.GlobalRate)
+	}
+
+	c, ok := l.clients[client]
+	if !ok {
+		c = &clientLimiter{limiter: updateLimiter(nil, now, l.limits.ClientRate, l.limits.ClientBurst)}
+		l.clients[client] = c
+	}
+	c.lastSeen = now
+
+	if !c.limiter.AllowN(now, 1) {
+		global.CancelAt(now)
+		l.metrics.RejectedClient++
+		return fmt.Errorf("rate limit exceeded: client %s may make %g requests per second", client, l.limits.ClientRate)
+	}
+
+	l.metrics.Allowed++
+	return nil
+}
+
+// startOperation reserves a slot for a filesystem operation. The returned
+// function releases it.
+func (l *Limiter) startOperation() (func(), error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.limits.MaxConcurrentOperations > 0 && l.inFlight >= l.limits.MaxConcurrentOperations {
+		l.metrics.RejectedConcurrency++
+		return nil, fmt.Errorf("too many concurrent operations: the driver runs at most %d at once", l.limits.MaxConcurrentOperations)
+	}
+
+	l.inFlight++
+	return func() {
+		l.lock.Lock()
+		l.inFlight--
+		l.lock.Unlock()
+	}, nil
+}
+
+func (l *Limiter) forgetIdleClients(now time.Time) {
+	for name, client := range l.clients {
+		if now.Sub(client.lastSeen) > clientIdleTimeout {
+			delete(l.clients, name)
+		}
+	}
+}
+
+// updateLimiter applies a rate to limiter. A limiter that was unlimited is
+// replaced by one that starts with a full bucket.
+func updateLimiter(limiter *rate.Limiter, now time.Time, perSecond float64, burst int) *rate.Limiter {
+	if perSecond == 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	if burst == 0 {
+		burst = int(math.Max(1, math.Ceil(perSecond)))
+	}
+	if limiter == nil || limiter.Limit() == rate.Inf {
+		return rate.NewLimiter(rate.Limit(perSecond), burst)
+	}
+	limiter.SetLimitAt(now, rate.Limit(perSecond))
+	limiter.SetBurstAt(now, burst)
+	return limiter
+}
+
+// clientID identifies the caller by the common name of its certificate,
+// falling back to its address.
+func clientID(req *http.Request) string {
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 && req.TLS.PeerCertificates[0].Subject.CommonName != "" {
+		return "CN=" + req.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	if req.RemoteAddr == "" || req.RemoteAddr == "@" {
+		return "unix"
+	}
+	return req.RemoteAddr
+}
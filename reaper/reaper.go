@@ -0,0 +1,101 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/localdriver"
+	"github.com/tedsuo/ifrit"
+)
+
+type VolumeReaper interface {
+	ReapExpired(env dockerdriver.Env) localdriver.ReapResponse
+}
+
+type Reaper struct {
+	logger       lager.Logger
+	volumeReaper VolumeReaper
+	clock        clock.Clock
+
+	lock            sync.Mutex
+	interval        time.Duration
+	intervalChanged chan struct{}
+}
+
+var _ ifrit.Runner = &Reaper{}
+
+// NewReaper returns a runner that releases expired mount leases, removes
+// expired volumes and purges old trash every interval.
+func NewReaper(logger lager.Logger, volumeReaper VolumeReaper, clock clock.Clock, interval time.Duration) *Reaper {
+	return &Reaper{
+		logger:          logger.Session("reaper"),
+		volumeReaper:    volumeReaper,
+		clock:           clock,
+		interval:        interval,
+		intervalChanged: make(chan struct{}, 1),
+	}
+}
+
+// SetInterval changes how often the reaper runs. The next run is scheduled a
+// full new interval from now.
+func (r *Reaper) SetInterval(interval time.Duration) {
+	r.lock.Lock()
+	r.interval = interval
+	r.lock.Unlock()
+
+	select {
+	case r.intervalChanged <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Reaper) Interval() time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.interval
+}
+
+func (r *Reaper) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	interval := r.Interval()
+	r.logger.Info("start", lager.Data{"interval": interval.String()})
+	defer r.logger.Info("end")
+
+	ticker := r.clock.NewTicker(interval)
+	defer func() { ticker.Stop() }()
+
+	close(ready)
+
+	for {
+		select {
+		case <-ticker.C():
+			r.reap()
+		case <-r.intervalChanged:
+			ticker.Stop()
+			interval = r.Interval()
+			r.logger.Info("interval-changed", lager.Data{"interval": interval.String()})
+			ticker = r.clock.NewTicker(interval)
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+func (r *Reaper) reap() {
+	logger := r.logger.Session("reap")
+	env := driverhttp.NewHttpDriverEnv(logger, context.Background())
+
+	response := r.volumeReaper.ReapExpired(env)
+	if response.Err != "" {
+		logger.Error("failed-reaping-volumes", errors.New(response.Err))
+	}
+	if len(response.Removed) > 0 || len(response.Mounted) > 0 || len(response.Purged) > 0 || len(response.Released) > 0 {
+		logger.Info("reaped", lager.Data{"removed": response.Removed, "expired-but-mounted": response.Mounted, "purged": response.Purged, "released-leases": response.Released})
+	}
+}
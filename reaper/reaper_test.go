@@ -0,0 +1,83 @@
+package reaper_test
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/localdriver"
+	"code.cloudfoundry.org/localdriver/reaper"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+type fakeVolumeReaper struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (f *fakeVolumeReaper) ReapExpired(_ dockerdriver.Env) localdriver.ReapResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return localdriver.ReapResponse{Removed: []string{"some-volume"}}
+}
+
+func (f *fakeVolumeReaper) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+var _ = Describe("Reaper", func() {
+	var (
+		volumeReaper *fakeVolumeReaper
+		fakeClock    *fakeclock.FakeClock
+		logger       *lagertest.TestLogger
+		runner       *reaper.Reaper
+		process      ifrit.Process
+	)
+
+	BeforeEach(func() {
+		volumeReaper = &fakeVolumeReaper{}
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		logger = lagertest.NewTestLogger("reaper")
+		runner = reaper.NewReaper(logger, volumeReaper, fakeClock, time.Minute)
+		process = ifrit.Invoke(runner)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	})
+
+	It("reaps expired volumes every interval", func() {
+		Consistently(volumeReaper.callCount).Should(Equal(0))
+
+		fakeClock.WaitForWatcherAndIncrement(time.Minute)
+		Eventually(volumeReaper.callCount).Should(Equal(1))
+
+		fakeClock.WaitForWatcherAndIncrement(time.Minute)
+		Eventually(volumeReaper.callCount).Should(Equal(2))
+	})
+
+	Context("when the interval is changed", func() {
+		BeforeEach(func() {
+			runner.SetInterval(time.Hour)
+			Eventually(logger.LogMessages).Should(ContainElement("reaper.reaper.interval-changed"))
+		})
+
+		It("reaps on the new interval", func() {
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Consistently(volumeReaper.callCount).Should(Equal(0))
+
+			fakeClock.WaitForWatcherAndIncrement(59 * time.Minute)
+			Eventually(volumeReaper.callCount).Should(Equal(1))
+			Expect(runner.Interval()).To(Equal(time.Hour))
+		})
+	})
+})
@@ -0,0 +1,102 @@
+package localdriver
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/bytefmt"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+type ResizeRequest struct {
+	Name string
+	Size uint64
+}
+
+// Resize changes the size limit of a tmpfs memory volume or an image volume.
+// A volume is never shrunk below what it already uses, and an image can only
+// shrink while it is not mounted.
+func (d *LocalDriver) Resize(env dockerdriver.Env, resizeRequest ResizeRequest) dockerdriver.ErrorResponse {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	logger := env.Logger().Session("resize", lager.Data{"volume": resizeRequest.Name, "size": resizeRequest.Size})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if resizeRequest.Name == "" {
+		return dockerdriver.ErrorResponse{Err: "Missing mandatory 'volume_name'"}
+	}
+	if resizeRequest.Size == 0 {
+		return dockerdriver.ErrorResponse{Err: "Missing mandatory 'size'"}
+	}
+
+	vol, ok := d.volumes[resizeRequest.Name]
+	if !ok {
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' not found", resizeRequest.Name)}
+	}
+	if vol.moving {
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' is being moved", vol.Name)}
+	}
+	if vol.Size == 0 {
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' has no size limit to change", vol.Name)}
+	}
+	if vol.MemoryDir != "" {
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' is kept in shared memory, where its size cannot be enforced", vol.Name)}
+	}
+	if resizeRequest.Size == vol.Size {
+		return dockerdriver.ErrorResponse{}
+	}
+	if vol.Medium == MediumMemory && resizeRequest.Size > d.maxMemoryVolumeSize {
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Memory volumes are limited to %s", bytefmt.ByteSize(d.maxMemoryVolumeSize))}
+	}
+
+	pool := d.volumePool(vol)
+	volumePath := d.volumePath(logger, pool.Path, vol.Name)
+	if resizeRequest.Size < vol.Size {
+		if vol.ImageMounted {
+			return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' is mounted and can only grow", vol.Name)}
+		}
+
+		used, err := d.volumeUsage(logger, vol, volumePath)
+		if err != nil {
+			logger.Error("failed-computing-volume-usage", err)
+			return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Failed resizing volume: %s", err)}
+		}
+		if used > resizeRequest.Size {
+			return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' uses %s, more than %s", vol.Name, bytefmt.ByteSize(used), bytefmt.ByteSize(resizeRequest.Size))}
+		}
+	} else if vol.Backend == BackendImage {
+		if free := d.poolFree(logger, pool); free < resizeRequest.Size-vol.Size {
+			return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Pool '%s' does not have room to grow volume '%s'", pool.Name, vol.Name)}
+		}
+	}
+
+	logger.Info("resizing-volume", lager.Data{"from": vol.Size})
+	var err error
+	switch {
+	case vol.Backend == BackendImage:
+		err = d.osHelper.ResizeImage(d.filepath.Join(volumePath, imageFileName), resizeRequest.Size)
+	case vol.Medium == MediumMemory:
+		err = d.osHelper.ResizeTmpfs(volumePath, resizeRequest.Size)
+	}
+	if err != nil {
+		logger.Error("failed-resizing-volume", err)
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Failed resizing volume: %s", err)}
+	}
+
+	vol.Size = resizeRequest.Size
+	return dockerdriver.ErrorResponse{}
+}
+
+// volumeUsage is the space allocated to the files of a volume. The image of
+// an unmounted image volume is mounted while it is measured.
+func (d *LocalDriver) volumeUsage(logger lager.Logger, vol *LocalVolumeInfo, volumePath string) (uint64, error) {
+	if vol.Backend == BackendImage && !vol.ImageMounted {
+		if err := d.attachImage(logger, vol, volumePath); err != nil {
+			return 0, err
+		}
+		defer d.detachImage(logger, vol, volumePath)
+	}
+	return d.diskUsage(d.dataPath(vol, volumePath))
+}
@@ -0,0 +1,93 @@
+package localdriver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/lager/v3"
+)
+
+// SubpathOption is the Mount option that mounts a directory inside the
+// volume instead of the whole volume.
+const SubpathOption = "subpath"
+
+// subpathFromOpts reads the "subpath" mount option, a path relative to the
+// volume root that must not lead out of it. The volume root itself is
+// returned as an empty subpath.
+func subpathFromOpts(opts map[string]interface{}) (string, error) {
+	raw, ok := opts[SubpathOption]
+	if !ok || raw == nil {
+		return "", nil
+	}
+
+	subpath, ok := raw.(string)
+	if !ok {
+		return "", fmt.Errorf("Invalid 'subpath' option: %v", raw)
+	}
+
+	cleaned := filepath.Clean(subpath)
+	if filepath.IsAbs(subpath) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Invalid 'subpath' option: '%s' must stay inside the volume", subpath)
+	}
+	if cleaned == "." {
+		return "", nil
+	}
+	return cleaned, nil
+}
+
+// subpathTarget creates the subpath inside the volume if it is missing and
+// returns its path. Directories it creates get the owner and mode of the
+// volume root. Symlinks along the way are refused, since they could point
+// out of the volume.
+func (d *LocalDriver) subpathTarget(logger lager.Logger, vol *LocalVolumeInfo, volumePath, subpath string) (string, error) {
+	mode := vol.Mode
+	if mode == 0 {
+		mode = os.ModePerm
+	}
+
+	target := volumePath
+	missing := false
+	for _, part := range strings.Split(subpath, string(filepath.Separator)) {
+		target = d.filepath.Join(target, part)
+		if !missing {
+			info, err := d.os.Lstat(target)
+			switch {
+			case os.IsNotExist(err):
+				missing = true
+			case err != nil:
+				return "", err
+			case info != nil && info.Mode()&os.ModeSymlink != 0:
+				return "", fmt.Errorf("Invalid 'subpath' option: '%s' is a symlink", subpath)
+			default:
+				continue
+			}
+		}
+
+		logger.Info("creating-subpath", lager.Data{"path": target})
+		if err := d.os.Mkdir(target, mode); err != nil {
+			return "", err
+		}
+		if vol.Mode != 0 {
+			if err := d.os.Chown(target, vol.UID, vol.GID); err != nil {
+				return "", err
+			}
+		}
+		if err := d.os.Chmod(target, mode); err != nil {
+			return "", err
+		}
+	}
+	return target, nil
+}
+
+// subpaths maps each holder that mounted a subpath to that subpath.
+func (vol *LocalVolumeInfo) subpaths() map[string]string {
+	subpaths := map[string]string{}
+	for id, holder := range vol.Holders {
+		if holder.Subpath != "" {
+			subpaths[id] = holder.Subpath
+		}
+	}
+	return subpaths
+}
@@ -0,0 +1,221 @@
+package localdriver
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3"
+)
+
+const TrashRootDir = "_trash"
+
+// trashTimeFormat is sortable and safe to use in a directory name.
+const trashTimeFormat = "20060102T150405.000000000Z"
+
+type TrashedVolume struct {
+	ID        string
+	Name      string
+	Pool      string
+	TrashedAt time.Time
+	PurgeAt   time.Time
+
+	path   string
+	volume LocalVolumeInfo
+	// recovered is set for volumes found in the trash at startup, whose
+	// metadata was lost with the previous process
+	recovered bool
+}
+
+type ListTrashResponse struct {
+	Volumes []TrashedVolume
+	Err     string
+}
+
+type RestoreRequest struct {
+	ID string
+}
+
+func (d *LocalDriver) trashVolume(logger lager.Logger, vol *LocalVolumeInfo, volumePath string) dockerdriver.ErrorResponse {
+	pool := d.volumePool(vol)
+	trashRoot := d.filepath.Join(pool.Path, TrashRootDir)
+	err := d.os.MkdirAll(trashRoot, 0700)
+	if err != nil {
+		logger.Error("failed-creating-trash", err, lager.Data{"path": trashRoot})
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Failed moving volume to trash: %s", err)}
+	}
+
+	now := d.clock.Now()
+	id := fmt.Sprintf("%s.%s", d.filepath.Base(volumePath), now.UTC().Format(trashTimeFormat))
+	trashPath := d.filepath.Join(trashRoot, id)
+
+	logger.Info("trash-volume-folder", lager.Data{"volume": volumePath, "trash": trashPath})
+	err = d.os.Rename(volumePath, trashPath)
+	if err != nil {
+		logger.Error("failed-trashing-volume", err)
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Failed moving volume to trash: %s", err)}
+	}
+
+	trashed := &TrashedVolume{
+		ID:        id,
+		Name:      vol.Name,
+		Pool:      pool.Name,
+		TrashedAt: now,
+		PurgeAt:   now.Add(d.trashRetention),
+		path:      trashPath,
+		volume:    *vol,
+	}
+	trashed.volume.Mountpoint = ""
+	trashed.volume.MountCount = 0
+	trashed.volume.Holders = nil
+	trashed.volume.ExpiresAt = time.Time{}
+	d.trash[id] = trashed
+
+	logger.Info("removing-volume", lager.Data{"name": vol.Name, "trash_id": id})
+	delete(d.volumes, vol.Name)
+	return dockerdriver.ErrorResponse{}
+}
+
+// recoverTrash rebuilds the trash from the trash directories of the pools, so
+// that volumes trashed before a restart are still purged and can be restored.
+// The directory name and the time the volume was trashed are taken from the
+// ID; labels and ownership are not kept on disk. Without a retention period
+// the recovered volumes are never purged, only restored.
+func (d *LocalDriver) recoverTrash() {
+	for _, pool := range d.pools {
+		paths, err := d.filepath.Glob(d.filepath.Join(pool.Path, TrashRootDir, "*"))
+		if err != nil {
+			continue
+		}
+
+		for _, path := range paths {
+			id := d.filepath.Base(path)
+			name, trashedAt, ok := parseTrashID(id)
+			if !ok {
+				continue
+			}
+
+			trashed := &TrashedVolume{
+				ID:        id,
+				Name:      name,
+				Pool:      pool.Name,
+				TrashedAt: trashedAt,
+				path:      path,
+				volume:    LocalVolumeInfo{VolumeInfo: dockerdriver.VolumeInfo{Name: name}, Pool: pool.Name},
+				recovered: true,
+			}
+			if d.trashRetention > 0 {
+				trashed.PurgeAt = trashedAt.Add(d.trashRetention)
+			}
+			image, imageErr := d.os.Stat(d.filepath.Join(path, imageFileName))
+			fs, fsErr := d.os.Stat(d.filepath.Join(path, imageMountDir))
+			if imageErr == nil && fsErr == nil && image.Mode().IsRegular() && fs.IsDir() {
+				trashed.volume.Backend = BackendImage
+				trashed.volume.Size = uint64(image.Size())
+			}
+			d.trash[id] = trashed
+		}
+	}
+}
+
+// parseTrashID splits the ID given by trashVolume into the name of the
+// volume directory and the time the volume was trashed.
+func parseTrashID(id string) (string, time.Time, bool) {
+	dot := len(id) - len(trashTimeFormat) - 1
+	if dot < 1 || id[dot] != '.' {
+		return "", time.Time{}, false
+	}
+	trashedAt, err := time.Parse(trashTimeFormat, id[dot+1:])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return id[:dot], trashedAt, true
+}
+
+// purgeTrash permanently removes the trashed volumes whose retention period
+// has passed and returns their IDs. Volumes without a PurgeAt are kept.
+func (d *LocalDriver) purgeTrash(logger lager.Logger, now time.Time) ([]string, []string) {
+	var purged, errs []string
+	for id, trashed := range d.trash {
+		if trashed.PurgeAt.IsZero() || now.Before(trashed.PurgeAt) {
+			continue
+		}
+
+		logger.Info("purging-trashed-volume", lager.Data{"trash_id": id, "path": trashed.path})
+		err := d.os.RemoveAll(trashed.path)
+		if err != nil {
+			logger.Error("failed-purging-trashed-volume", err, lager.Data{"trash_id": id})
+			errs = append(errs, err.Error())
+			continue
+		}
+		delete(d.trash, id)
+		purged = append(purged, id)
+	}
+	return purged, errs
+}
+
+func (d *LocalDriver) ListTrash(env dockerdriver.Env) ListTrashResponse {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	response := ListTrashResponse{Volumes: []TrashedVolume{}}
+	for _, trashed := range d.trash {
+		response.Volumes = append(response.Volumes, *trashed)
+	}
+	sort.Slice(response.Volumes, func(i, j int) bool {
+		return response.Volumes[i].ID < response.Volumes[j].ID
+	})
+	return response
+}
+
+// Restore brings a trashed volume back under its original name, provided no
+// other volume has taken that name in the meantime.
+func (d *LocalDriver) Restore(env dockerdriver.Env, restoreRequest RestoreRequest) dockerdriver.ErrorResponse {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	logger := env.Logger().Session("restore", lager.Data{"trash_id": restoreRequest.ID})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if restoreRequest.ID == "" {
+		return dockerdriver.ErrorResponse{Err: "Missing mandatory 'id'"}
+	}
+
+	trashed, ok := d.trash[restoreRequest.ID]
+	if !ok {
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Trashed volume '%s' not found", restoreRequest.ID)}
+	}
+
+	// with unique volume IDs the directory only holds part of the name
+	if trashed.recovered && d.uniqueVolumeIds {
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Trashed volume '%s' was found at startup and its original name is unknown", restoreRequest.ID)}
+	}
+
+	if _, exists := d.volumes[trashed.Name]; exists {
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Volume '%s' already exists", trashed.Name)}
+	}
+
+	vol := trashed.volume
+	volumePath := d.volumePath(logger, d.volumePool(&vol).Path, vol.Name)
+	exists, err := d.exists(volumePath)
+	if err != nil {
+		logger.Error("failed-checking-volume-path", err, lager.Data{"path": volumePath})
+		return dockerdriver.ErrorResponse{Err: err.Error()}
+	}
+	if exists {
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Path '%s' is already in use", volumePath)}
+	}
+
+	logger.Info("restore-volume-folder", lager.Data{"trash": trashed.path, "volume": volumePath})
+	err = d.os.Rename(trashed.path, volumePath)
+	if err != nil {
+		logger.Error("failed-restoring-volume", err)
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("Failed restoring volume: %s", err)}
+	}
+
+	d.volumes[vol.Name] = &vol
+	delete(d.trash, restoreRequest.ID)
+	return dockerdriver.ErrorResponse{}
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package localdriver
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileUsage returns the bytes allocated to the file info describes, which is
+// less than its size when the file is sparse, and the device it is on.
+func fileUsage(info os.FileInfo) (uint64, uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return uint64(info.Size()), 0, false
+	}
+	return uint64(stat.Blocks) * 512, uint64(stat.Dev), true
+}